@@ -0,0 +1,112 @@
+package api
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"wager-exchange/internal/model"
+	"wager-exchange/internal/ratelimit"
+)
+
+// routeWeight classifies a request into a rate-limit class and a token
+// weight, per the endpoint weights agreed with the trading desk
+// (placeOrder=1, cancelOrder=1, listMarkets=5, etc).
+func routeWeight(method, path string) (ratelimit.Class, int) {
+	switch {
+	case method == http.MethodPost && strings.HasSuffix(path, "/orders"):
+		return ratelimit.ClassTrade, 1
+	case method == http.MethodPost && strings.HasSuffix(path, "/orders/batch"):
+		return ratelimit.ClassTrade, 1
+	case method == http.MethodDelete && strings.HasPrefix(path, "/api/orders/"):
+		return ratelimit.ClassTrade, 1
+	case strings.HasPrefix(path, "/api/admin/"):
+		return ratelimit.ClassAccount, 1
+	case method == http.MethodGet && strings.HasPrefix(path, "/api/markets"):
+		return ratelimit.ClassPublic, 5
+	case strings.HasPrefix(path, "/api/"):
+		return ratelimit.ClassAccount, 1
+	default:
+		return ratelimit.ClassPublic, 1
+	}
+}
+
+// rateLimitIdentity extracts a bucketing identity and role for a request
+// ahead of authMiddleware: an API key counts only once its signature
+// verifies and a bearer token only once peekJWT validates it; anything
+// else falls back to the remote IP, so a forged header only costs the
+// caller their own bucket, never someone else's.
+func (s *Server) rateLimitIdentity(r *http.Request) (identity string, role ratelimit.Role) {
+	if key := r.Header.Get("X-API-KEY"); key != "" {
+		body, _ := io.ReadAll(r.Body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		if _, _, _, err := s.apiKeyAuth(r, body); err == nil {
+			return key, ratelimit.RoleAPIKey
+		}
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		if uid, isAdmin, ok := s.peekJWT(strings.TrimPrefix(auth, "Bearer ")); ok {
+			if isAdmin {
+				return uid, ratelimit.RoleAdmin
+			}
+			return uid, ratelimit.RoleUser
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return host, ratelimit.RoleAnon
+}
+
+// peekJWT validates a bearer token and returns its subject, without
+// touching the DB, so the rate limiter can bucket by user before
+// authMiddleware runs.
+func (s *Server) peekJWT(tokenStr string) (userID string, isAdmin bool, ok bool) {
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return s.secret, nil
+	})
+	if err != nil || !token.Valid {
+		return "", false, false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", false, false
+	}
+	userID, _ = claims["sub"].(string)
+	role, _ := claims["role"].(string)
+	return userID, role == string(model.RoleAdmin), userID != ""
+}
+
+// rateLimitMiddleware enforces per-identity, per-class token buckets and
+// reports the outcome via the standard X-RateLimit-* headers.
+func (s *Server) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/health" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		class, weight := routeWeight(r.Method, r.URL.Path)
+		identity, role := s.rateLimitIdentity(r)
+		res := s.limiter.Allow(identity, role, class, weight)
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(res.Limit))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(res.ResetAt.Unix(), 10))
+
+		if !res.Allowed {
+			jsonErr(w, http.StatusTooManyRequests, "rate limit exceeded: "+string(class)+" bucket")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
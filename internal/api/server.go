@@ -1,9 +1,11 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
@@ -18,25 +20,34 @@ import (
 	"wager-exchange/internal/db"
 	"wager-exchange/internal/engine"
 	"wager-exchange/internal/model"
+	"wager-exchange/internal/payment"
+	"wager-exchange/internal/ratelimit"
 	"wager-exchange/internal/ws"
 )
 
 type Server struct {
-	store   *db.Store
-	manager *engine.Manager
-	hub     *ws.Hub
-	secret  []byte
-	feeBps  int
+	store    *db.Store
+	manager  *engine.Manager
+	hub      *ws.Hub
+	secret   []byte
+	feeBps   int
+	limiter  *ratelimit.Limiter
+	provider payment.Provider
 }
 
-func NewServer(store *db.Store, mgr *engine.Manager, hub *ws.Hub, secret string, feeBps int) *Server {
-	return &Server{store: store, manager: mgr, hub: hub, secret: []byte(secret), feeBps: feeBps}
+func NewServer(store *db.Store, mgr *engine.Manager, hub *ws.Hub, secret string, feeBps int, provider payment.Provider) *Server {
+	return &Server{store: store, manager: mgr, hub: hub, secret: []byte(secret), feeBps: feeBps, limiter: ratelimit.New(), provider: provider}
 }
 
+// Limiter exposes the server's rate limiter so the WS hub can charge
+// subscribe/unsubscribe ops against the same account bucket as REST calls.
+func (s *Server) Limiter() *ratelimit.Limiter { return s.limiter }
+
 func (s *Server) Router() http.Handler {
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(s.rateLimitMiddleware)
 	r.Use(middleware.Timeout(30 * time.Second))
 	r.Use(corsMiddleware)
 
@@ -59,17 +70,33 @@ func (s *Server) Router() http.Handler {
 		// Wallet
 		r.Get("/api/wallet", s.getWallet)
 
+		// Deposits & withdrawals
+		r.Post("/api/deposits", s.createDeposit)
+		r.Post("/api/withdrawals", s.requestWithdrawal)
+
+		// API keys
+		r.Post("/api/api-keys", s.createAPIKey)
+
 		// Markets
 		r.Get("/api/markets", s.listMarkets)
 		r.Get("/api/markets/{id}", s.getMarket)
 		r.Get("/api/markets/{id}/book", s.getBook)
 		r.Get("/api/markets/{id}/trades", s.getTrades)
+		r.Get("/api/markets/{id}/klines", s.getKlines)
+		r.Get("/api/markets/{id}/instrument", s.getInstrument)
 
 		// Orders
 		r.Post("/api/markets/{id}/orders", s.placeOrder)
+		r.Post("/api/markets/{id}/orders/batch", s.placeOrdersBatch)
+		r.Post("/api/markets/{id}/orders/batch-retry", s.placeOrdersBatchRetry)
 		r.Delete("/api/orders/{id}", s.cancelOrder)
 		r.Get("/api/markets/{id}/orders", s.listOrders)
 
+		// Multi-leg trades (grouped orders that live/die together, possibly
+		// spanning several markets)
+		r.Post("/api/multi-trades", s.placeMultiTrade)
+		r.Delete("/api/multi-trades/{group_id}", s.cancelGroup)
+
 		// Positions
 		r.Get("/api/markets/{id}/positions", s.listPositions)
 
@@ -84,7 +111,13 @@ func (s *Server) Router() http.Handler {
 			r.Use(s.adminOnly)
 			r.Post("/api/admin/markets", s.createMarket)
 			r.Post("/api/admin/markets/{id}/resolve", s.resolveMarket)
+			r.Post("/api/admin/markets/{id}/instrument", s.updateInstrument)
+			r.Post("/api/admin/markets/{id}/suspend", s.suspendMarket)
+			r.Post("/api/admin/markets/{id}/resume", s.resumeMarket)
 			r.Post("/api/admin/deposit", s.adminDeposit)
+			r.Post("/api/admin/deposits/confirm", s.confirmDeposit)
+			r.Post("/api/admin/withdrawals/{id}/settle", s.settleWithdrawal)
+			r.Post("/api/admin/withdrawals/{id}/fail", s.failWithdrawal)
 			r.Get("/api/admin/users", s.listUsers)
 			r.Get("/api/admin/events", s.listEvents)
 			r.Get("/api/admin/metrics", s.metrics)
@@ -186,10 +219,27 @@ type ctxKey string
 const (
 	ctxUserID ctxKey = "userID"
 	ctxRole   ctxKey = "role"
+	ctxPerms  ctxKey = "perms"
 )
 
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Signed API keys bypass JWT entirely, for bot/market-maker clients.
+		if r.Header.Get("X-API-KEY") != "" {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			userID, role, perms, err := s.apiKeyAuth(r, body)
+			if err != nil {
+				jsonErr(w, 401, "invalid api key: "+err.Error())
+				return
+			}
+			ctx := context.WithValue(r.Context(), ctxUserID, userID)
+			ctx = context.WithValue(ctx, ctxRole, role)
+			ctx = context.WithValue(ctx, ctxPerms, perms)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
 		auth := r.Header.Get("Authorization")
 		if !strings.HasPrefix(auth, "Bearer ") {
 			jsonErr(w, 401, "missing token")
@@ -230,6 +280,22 @@ func (s *Server) adminOnly(next http.Handler) http.Handler {
 	})
 }
 
+// hasPermission reports whether the request is allowed to perform an
+// action requiring perm. JWT-authenticated requests carry no ctxPerms and
+// are always allowed; API-key requests must have been scoped with perm.
+func hasPermission(r *http.Request, perm model.APIKeyPermission) bool {
+	perms, ok := r.Context().Value(ctxPerms).([]model.APIKeyPermission)
+	if !ok {
+		return true
+	}
+	for _, p := range perms {
+		if p == perm || p == model.PermAdmin {
+			return true
+		}
+	}
+	return false
+}
+
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -255,6 +321,97 @@ func (s *Server) getWallet(w http.ResponseWriter, r *http.Request) {
 	json200(w, wallet)
 }
 
+// createDeposit records a user-initiated deposit as PENDING. It does not
+// credit the wallet itself: crediting only happens once the provider
+// confirms the transfer actually landed, via confirmDeposit.
+func (s *Server) createDeposit(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxUserID).(string)
+	var req struct {
+		Asset         string `json:"asset"`
+		AmountCents   int64  `json:"amount_cents"`
+		ExternalTxnID string `json:"external_txn_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if req.Asset == "" || req.AmountCents <= 0 || req.ExternalTxnID == "" {
+		jsonErr(w, 400, "asset, amount_cents > 0, and external_txn_id required")
+		return
+	}
+	d, err := s.store.CreateDeposit(r.Context(), uid, req.Asset, req.AmountCents, 0, s.provider.Name(), req.ExternalTxnID)
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, d)
+}
+
+// requestWithdrawal locks the requested funds and hands the payout off
+// to the configured PaymentProvider. The wallet balance isn't debited
+// until an admin settles the withdrawal (or the provider's own callback
+// does, once one exists) via settleWithdrawal.
+func (s *Server) requestWithdrawal(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxUserID).(string)
+	var req struct {
+		Asset       string `json:"asset"`
+		AmountCents int64  `json:"amount_cents"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if req.Asset == "" || req.AmountCents <= 0 {
+		jsonErr(w, 400, "asset and amount_cents > 0 required")
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := s.store.BeginTx(ctx)
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+
+	wallet, err := s.store.GetWalletForUpdate(tx, uid)
+	if err != nil {
+		jsonErr(w, 404, "wallet not found")
+		return
+	}
+	if wallet.Available() < req.AmountCents {
+		jsonErr(w, 400, "insufficient available balance")
+		return
+	}
+	wd, err := s.store.RequestWithdrawal(tx, uid, req.Asset, req.AmountCents, 0, s.provider.Name())
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+
+	// The provider call happens after commit: a pending withdrawal row
+	// must exist before we hand anything to an external rail, and a
+	// network call has no business holding the wallet row lock open.
+	externalTxnID, err := s.provider.InitiateWithdrawal(ctx, uid, req.AmountCents)
+	if err != nil {
+		log.Printf("[withdrawal] provider InitiateWithdrawal failed for %s: %v", wd.ID, err)
+		json200(w, wd)
+		return
+	}
+	if externalTxnID != "" {
+		if err := s.store.SetWithdrawalExternalTxnID(ctx, wd.ID, externalTxnID); err != nil {
+			log.Printf("[withdrawal] failed to record external_txn_id for %s: %v", wd.ID, err)
+		} else {
+			wd.ExternalTxnID = &externalTxnID
+		}
+	}
+	json200(w, wd)
+}
+
 // ── Markets ──────────────────────────────────────────
 
 func (s *Server) listMarkets(w http.ResponseWriter, r *http.Request) {
@@ -303,37 +460,172 @@ func (s *Server) getTrades(w http.ResponseWriter, r *http.Request) {
 	json200(w, trades)
 }
 
+var validKlineIntervals = map[string]bool{"1m": true, "5m": true, "15m": true, "1h": true, "4h": true, "1d": true}
+
+func (s *Server) getKlines(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	interval := r.URL.Query().Get("interval")
+	if interval == "" {
+		interval = "1m"
+	}
+	if !validKlineIntervals[interval] {
+		jsonErr(w, 400, "interval must be one of 1m,5m,15m,1h,4h,1d")
+		return
+	}
+
+	start := time.Unix(0, 0)
+	end := time.Now().Add(24 * time.Hour)
+	if v := r.URL.Query().Get("start"); v != "" {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			start = time.UnixMilli(ms)
+		}
+	}
+	if v := r.URL.Query().Get("end"); v != "" {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			end = time.UnixMilli(ms)
+		}
+	}
+	limit := 500
+	if n, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && n > 0 && n <= 1000 {
+		limit = n
+	}
+
+	klines, err := s.store.ListKlines(r.Context(), id, interval, start, end, limit)
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	if klines == nil {
+		klines = []model.Kline{}
+	}
+	if cur, ok := s.manager.GetCurrentKline(id, interval); ok && !cur.OpenTime.Before(start) && cur.OpenTime.Before(end) {
+		klines = append(klines, cur)
+	}
+	json200(w, klines)
+}
+
+func (s *Server) getInstrument(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	mkt, err := s.store.GetMarket(r.Context(), id)
+	if err != nil || mkt == nil {
+		jsonErr(w, 404, "market not found")
+		return
+	}
+	json200(w, mkt.Instrument)
+}
+
 // ── Orders ───────────────────────────────────────────
 
+// validatePlaceOrderReq checks the basic shape of a single order within a
+// place-order request, independent of market state or engine limits (which
+// are enforced by the engine itself). Returns an empty string if req is
+// well-formed.
+func validatePlaceOrderReq(req model.PlaceOrderReq) string {
+	if req.Side != model.SideBuy && req.Side != model.SideSell {
+		return "side must be BUY or SELL"
+	}
+	if req.Type != model.TypeLimit && req.Type != model.TypeMarket {
+		return "type must be LIMIT or MARKET"
+	}
+	if req.Type == model.TypeLimit && (req.PriceCents == nil || *req.PriceCents < 1 || *req.PriceCents > 99) {
+		return "limit price must be 1-99"
+	}
+	if req.Qty < 1 {
+		return "qty must be >= 1"
+	}
+	switch req.TimeInForce {
+	case "", model.TIFGTC, model.TIFIOC, model.TIFFOK:
+	case model.TIFGTT:
+		if req.CancelAfterSeconds == nil || *req.CancelAfterSeconds < 1 {
+			return "GTT requires cancel_after_seconds >= 1"
+		}
+	default:
+		return "time_in_force must be GTC, IOC, FOK, or GTT"
+	}
+	if req.PostOnly && req.Type != model.TypeLimit {
+		return "post_only only valid for LIMIT orders"
+	}
+	if req.DisplayQty < 0 || req.DisplayQty > req.Qty {
+		return "display_qty must be between 0 and qty"
+	}
+	switch req.SelfTradePrevention {
+	case "", model.STPCancelTaker, model.STPCancelMaker, model.STPCancelBoth:
+	default:
+		return "self_trade_prevention must be CANCEL_TAKER, CANCEL_MAKER, or CANCEL_BOTH"
+	}
+	return ""
+}
+
 func (s *Server) placeOrder(w http.ResponseWriter, r *http.Request) {
 	marketID := chi.URLParam(r, "id")
 	uid := r.Context().Value(ctxUserID).(string)
 
+	if !hasPermission(r, model.PermTrade) {
+		jsonErr(w, 403, "api key missing trade permission")
+		return
+	}
+
 	var req model.PlaceOrderReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonErr(w, 400, "invalid json")
 		return
 	}
 
-	// Validate basic fields
-	if req.Side != model.SideBuy && req.Side != model.SideSell {
-		jsonErr(w, 400, "side must be BUY or SELL")
+	if reason := validatePlaceOrderReq(req); reason != "" {
+		jsonErr(w, 400, reason)
 		return
 	}
-	if req.Type != model.TypeLimit && req.Type != model.TypeMarket {
-		jsonErr(w, 400, "type must be LIMIT or MARKET")
+
+	// Check market exists & is open
+	mkt, err := s.store.GetMarket(r.Context(), marketID)
+	if err != nil || mkt == nil {
+		jsonErr(w, 404, "market not found")
 		return
 	}
-	if req.Type == model.TypeLimit && (req.PriceCents == nil || *req.PriceCents < 1 || *req.PriceCents > 99) {
-		jsonErr(w, 400, "limit price must be 1-99")
+	if mkt.Status != model.MarketOpen {
+		jsonErr(w, 400, "market not open")
 		return
 	}
-	if req.Qty < 1 {
-		jsonErr(w, 400, "qty must be >= 1")
+
+	result, err := s.manager.PlaceOrderWithRetry(r.Context(), marketID, uid, req, model.DefaultRetryPolicy())
+	if err != nil {
+		jsonErr(w, 500, err.Error())
 		return
 	}
+	if result.Status == model.StatusRejected {
+		jsonErr(w, 400, result.Reason)
+		return
+	}
+	json200(w, result)
+}
+
+// placeOrdersBatch places several orders from one user within a single
+// engine tick and DB transaction, e.g. a market maker laddering a book.
+func (s *Server) placeOrdersBatch(w http.ResponseWriter, r *http.Request) {
+	marketID := chi.URLParam(r, "id")
+	uid := r.Context().Value(ctxUserID).(string)
+
+	if !hasPermission(r, model.PermTrade) {
+		jsonErr(w, 403, "api key missing trade permission")
+		return
+	}
+
+	var req model.BatchPlaceOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if len(req.Orders) == 0 {
+		jsonErr(w, 400, "orders must not be empty")
+		return
+	}
+	for i, o := range req.Orders {
+		if reason := validatePlaceOrderReq(o); reason != "" {
+			jsonErr(w, 400, fmt.Sprintf("order %d: %s", i, reason))
+			return
+		}
+	}
 
-	// Check market exists & is open
 	mkt, err := s.store.GetMarket(r.Context(), marketID)
 	if err != nil || mkt == nil {
 		jsonErr(w, 404, "market not found")
@@ -344,24 +636,130 @@ func (s *Server) placeOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	eng := s.manager.GetEngine(marketID)
-	if eng == nil {
-		jsonErr(w, 500, "engine not running")
+	result, err := s.manager.PlaceOrdersBatch(marketID, uid, req)
+	if err != nil {
+		jsonErr(w, 500, err.Error())
 		return
 	}
+	json200(w, result)
+}
 
-	result := eng.PlaceOrder(uid, req)
-	if result.Status == model.StatusRejected {
-		jsonErr(w, 400, result.Reason)
+// placeOrdersBatchRetry places each order in the request independently
+// (no shared transaction, no all-or-none semantics), retrying only the
+// orders that fail for a transient reason. Unlike placeOrdersBatch, one
+// order's failure never blocks or rolls back the others — a market maker
+// streaming an order ladder gets back every leg's outcome even if one leg
+// hit a passing DB contention error that a retry resolved.
+func (s *Server) placeOrdersBatchRetry(w http.ResponseWriter, r *http.Request) {
+	marketID := chi.URLParam(r, "id")
+	uid := r.Context().Value(ctxUserID).(string)
+
+	if !hasPermission(r, model.PermTrade) {
+		jsonErr(w, 403, "api key missing trade permission")
+		return
+	}
+
+	var req model.BatchRetryPlaceOrderReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if len(req.Orders) == 0 {
+		jsonErr(w, 400, "orders must not be empty")
+		return
+	}
+	for i, o := range req.Orders {
+		if reason := validatePlaceOrderReq(o); reason != "" {
+			jsonErr(w, 400, fmt.Sprintf("order %d: %s", i, reason))
+			return
+		}
+	}
+
+	mkt, err := s.store.GetMarket(r.Context(), marketID)
+	if err != nil || mkt == nil {
+		jsonErr(w, 404, "market not found")
+		return
+	}
+	if mkt.Status != model.MarketOpen {
+		jsonErr(w, 400, "market not open")
+		return
+	}
+
+	policy := model.DefaultRetryPolicy()
+	if req.Policy != nil {
+		policy = *req.Policy
+	}
+
+	results, err := s.manager.BatchPlaceOrdersWithRetry(r.Context(), marketID, uid, req.Orders, policy)
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, model.BatchRetryPlaceOrderResult{Results: results})
+}
+
+// placeMultiTrade places a MultiTradeReq's legs, possibly across several
+// markets, as one group that lives or dies together: a rejected leg
+// cancels every leg already placed.
+func (s *Server) placeMultiTrade(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value(ctxUserID).(string)
+
+	if !hasPermission(r, model.PermTrade) {
+		jsonErr(w, 403, "api key missing trade permission")
+		return
+	}
+
+	var req model.MultiTradeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if len(req.Legs) == 0 {
+		jsonErr(w, 400, "legs must not be empty")
+		return
+	}
+	for i, leg := range req.Legs {
+		if leg.MarketID == "" {
+			jsonErr(w, 400, fmt.Sprintf("leg %d: market_id required", i))
+			return
+		}
+		if reason := validatePlaceOrderReq(model.PlaceOrderReq{Side: leg.Side, Type: model.TypeLimit, PriceCents: leg.PriceCents, Qty: leg.Qty}); reason != "" {
+			jsonErr(w, 400, fmt.Sprintf("leg %d: %s", i, reason))
+			return
+		}
+	}
+
+	result, err := s.manager.PlaceMultiTrade(uid, req)
+	if err != nil {
+		jsonErr(w, 500, err.Error())
 		return
 	}
 	json200(w, result)
 }
 
+// cancelGroup cancels every still-resting leg of a MultiTrade group.
+func (s *Server) cancelGroup(w http.ResponseWriter, r *http.Request) {
+	if !hasPermission(r, model.PermTrade) {
+		jsonErr(w, 403, "api key missing trade permission")
+		return
+	}
+	groupID := chi.URLParam(r, "group_id")
+	if err := s.manager.CancelGroup(groupID); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, map[string]string{"status": "canceled"})
+}
+
 func (s *Server) cancelOrder(w http.ResponseWriter, r *http.Request) {
 	orderID := chi.URLParam(r, "id")
 	uid := r.Context().Value(ctxUserID).(string)
 
+	if !hasPermission(r, model.PermTrade) {
+		jsonErr(w, 403, "api key missing trade permission")
+		return
+	}
+
 	// Get order to find market
 	order, err := s.store.GetOrder(r.Context(), orderID)
 	if err != nil || order == nil {
@@ -495,10 +893,12 @@ func (s *Server) createSideBet(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) createMarket(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Slug        string `json:"slug"`
-		Title       string `json:"title"`
-		Description string `json:"description"`
-		TickSize    int    `json:"tick_size_cents"`
+		Slug            string             `json:"slug"`
+		Title           string             `json:"title"`
+		Description     string             `json:"description"`
+		TickSize        int                `json:"tick_size_cents"`
+		MatchingMode    model.MatchingMode `json:"matching_mode"`
+		EpochDurationMs int                `json:"epoch_duration_ms"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		jsonErr(w, 400, "invalid json")
@@ -511,8 +911,20 @@ func (s *Server) createMarket(w http.ResponseWriter, r *http.Request) {
 	if req.TickSize <= 0 {
 		req.TickSize = 1
 	}
+	switch req.MatchingMode {
+	case "", model.ModeContinuous:
+		req.MatchingMode = model.ModeContinuous
+	case model.ModeEpoch:
+		if req.EpochDurationMs < 1000 {
+			jsonErr(w, 400, "epoch_duration_ms must be >= 1000 for EPOCH matching mode")
+			return
+		}
+	default:
+		jsonErr(w, 400, "matching_mode must be CONTINUOUS or EPOCH")
+		return
+	}
 
-	mkt, err := s.store.CreateMarket(r.Context(), req.Slug, req.Title, req.Description, req.TickSize)
+	mkt, err := s.store.CreateMarket(r.Context(), req.Slug, req.Title, req.Description, req.TickSize, req.MatchingMode, req.EpochDurationMs)
 	if err != nil {
 		jsonErr(w, 500, err.Error())
 		return
@@ -556,6 +968,59 @@ func (s *Server) resolveMarket(w http.ResponseWriter, r *http.Request) {
 	json200(w, map[string]string{"status": "resolved", "resolves_to": req.ResolvesTo})
 }
 
+func (s *Server) suspendMarket(w http.ResponseWriter, r *http.Request) {
+	marketID := chi.URLParam(r, "id")
+
+	var req struct {
+		Purge     bool       `json:"purge"`
+		SuspendAt *time.Time `json:"suspend_at,omitempty"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if req.SuspendAt != nil && req.SuspendAt.Before(time.Now()) {
+		jsonErr(w, 400, "suspend_at must be in the future")
+		return
+	}
+
+	if err := s.manager.SuspendMarket(r.Context(), marketID, req.Purge, req.SuspendAt); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, map[string]any{"status": "suspend requested", "purge": req.Purge, "suspend_at": req.SuspendAt})
+}
+
+func (s *Server) resumeMarket(w http.ResponseWriter, r *http.Request) {
+	marketID := chi.URLParam(r, "id")
+	if err := s.manager.ResumeMarket(r.Context(), marketID); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, map[string]string{"status": "resumed"})
+}
+
+func (s *Server) updateInstrument(w http.ResponseWriter, r *http.Request) {
+	marketID := chi.URLParam(r, "id")
+	adminID := r.Context().Value(ctxUserID).(string)
+
+	var req model.Instrument
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if req.PriceTickCents < 1 || req.QtyLotSize < 1 || req.MinQty < 1 || req.MaxQty < req.MinQty {
+		jsonErr(w, 400, "invalid instrument limits")
+		return
+	}
+
+	if err := s.manager.UpdateInstrument(marketID, req, adminID); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, req)
+}
+
 func (s *Server) adminDeposit(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserID string `json:"user_id"`
@@ -577,6 +1042,81 @@ func (s *Server) adminDeposit(w http.ResponseWriter, r *http.Request) {
 	json200(w, wallet)
 }
 
+// confirmDeposit settles a deposit created via createDeposit, crediting
+// the wallet. It stands in for the provider's real webhook callback
+// until one is wired up with signature verification; until then ops
+// (or a trusted integration) call it directly.
+func (s *Server) confirmDeposit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Provider      string `json:"provider"`
+		ExternalTxnID string `json:"external_txn_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		jsonErr(w, 400, "invalid json")
+		return
+	}
+	if req.Provider == "" || req.ExternalTxnID == "" {
+		jsonErr(w, 400, "provider and external_txn_id required")
+		return
+	}
+	tx, err := s.store.BeginTx(r.Context())
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	d, err := s.store.ConfirmDeposit(tx, req.Provider, req.ExternalTxnID)
+	if err != nil {
+		jsonErr(w, 404, "deposit not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, d)
+}
+
+func (s *Server) settleWithdrawal(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	tx, err := s.store.BeginTx(r.Context())
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	wd, err := s.store.MarkWithdrawalSettled(tx, id)
+	if err != nil {
+		jsonErr(w, 404, "withdrawal not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, wd)
+}
+
+func (s *Server) failWithdrawal(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	tx, err := s.store.BeginTx(r.Context())
+	if err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	defer tx.Rollback()
+	wd, err := s.store.MarkWithdrawalFailed(tx, id)
+	if err != nil {
+		jsonErr(w, 404, "withdrawal not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		jsonErr(w, 500, err.Error())
+		return
+	}
+	json200(w, wd)
+}
+
 func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := s.store.GetWalletUsers(r.Context())
 	if err != nil {
@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+	"wager-exchange/internal/model"
+)
+
+// event_outbox is unmigrated, snapshot-only (see the deposits/withdrawals
+// comment in store.go for why): it mirrors event_log but adds the
+// `shipped` flag a background dispatcher flips once a topic has been
+// handed to every live subscriber.
+//
+//   CREATE TABLE event_outbox (
+//       id           bigserial PRIMARY KEY,
+//       market_id    uuid REFERENCES markets(id),
+//       topic        text NOT NULL,
+//       payload_json jsonb NOT NULL,
+//       shipped      boolean NOT NULL DEFAULT false,
+//       created_at   timestamptz NOT NULL DEFAULT now()
+//   );
+//   CREATE INDEX ON event_outbox (shipped, id) WHERE NOT shipped;
+
+// PublishEvent writes a strongly-typed event to the outbox in the same
+// transaction as the domain change it describes, so the two commit or
+// roll back together. The background dispatcher (see DrainOutbox) is
+// what actually delivers it — this call never blocks on a subscriber.
+func PublishEvent[T any](tx *sql.Tx, marketID *string, topic model.Topic, payload T) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		`INSERT INTO event_outbox (market_id, topic, payload_json) VALUES ($1,$2,$3)`,
+		marketID, topic, b,
+	)
+	return err
+}
+
+// DrainOutbox returns up to limit unshipped events, oldest first, for the
+// dispatcher to hand off. It does not mark them shipped; the caller does
+// that via MarkOutboxShipped once delivery actually succeeds.
+func (s *Store) DrainOutbox(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT id, market_id, topic, payload_json, shipped, created_at
+		 FROM event_outbox WHERE NOT shipped ORDER BY id LIMIT $1`, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.OutboxEvent
+	for rows.Next() {
+		var ev model.OutboxEvent
+		if err := rows.Scan(&ev.ID, &ev.MarketID, &ev.Topic, &ev.PayloadJSON, &ev.Shipped, &ev.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, ev)
+	}
+	return out, nil
+}
+
+// MarkOutboxShipped flips the given rows to shipped so DrainOutbox won't
+// redeliver them. Delivery is therefore at-least-once: a crash between
+// DrainOutbox and this call redelivers on the next poll.
+func (s *Store) MarkOutboxShipped(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := s.DB.ExecContext(ctx, `UPDATE event_outbox SET shipped=true WHERE id = ANY($1)`, pq.Array(ids))
+	return err
+}
@@ -5,12 +5,13 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/golang-migrate/migrate/v4"
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"wager-exchange/internal/model"
 )
 
@@ -160,22 +161,282 @@ func RecalcLocked(tx *sql.Tx, userID string) error {
 	return err
 }
 
+// ── Deposits & Withdrawals ───────────────────────────
+//
+// deposits and withdrawals are unmigrated, snapshot-only: this package
+// has no migrations directory to extend, so the schema below (mirroring
+// the deposit/withdraw tables from the bbgo-style exchange migrations
+// this was modeled on) is documented here rather than in a .sql file.
+//
+//   CREATE TABLE deposits (
+//       id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+//       user_id         uuid NOT NULL REFERENCES users(id),
+//       asset           text NOT NULL,
+//       amount_cents    bigint NOT NULL,
+//       external_txn_id text NOT NULL,
+//       provider        text NOT NULL,
+//       status          text NOT NULL DEFAULT 'PENDING',
+//       fee_cents       bigint NOT NULL DEFAULT 0,
+//       created_at      timestamptz NOT NULL DEFAULT now(),
+//       confirmed_at    timestamptz,
+//       UNIQUE (provider, external_txn_id)
+//   );
+//   CREATE TABLE withdrawals (
+//       id              uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+//       user_id         uuid NOT NULL REFERENCES users(id),
+//       asset           text NOT NULL,
+//       amount_cents    bigint NOT NULL,
+//       external_txn_id text,
+//       provider        text NOT NULL,
+//       status          text NOT NULL DEFAULT 'PENDING',
+//       fee_cents       bigint NOT NULL DEFAULT 0,
+//       created_at      timestamptz NOT NULL DEFAULT now(),
+//       confirmed_at    timestamptz,
+//       UNIQUE (provider, external_txn_id)
+//   );
+
+// CreateDeposit records an inbound funds movement as PENDING. externalTxnID
+// is whatever reference the provider (or, for Manual, the operator) uses
+// to identify the transfer; it together with provider is unique, so a
+// replayed webhook resolves to this same row instead of minting a
+// duplicate credit.
+func (s *Store) CreateDeposit(ctx context.Context, userID, asset string, amountCents, feeCents int64, provider, externalTxnID string) (*model.Deposit, error) {
+	d := &model.Deposit{UserID: userID, Asset: asset, AmountCents: amountCents, ExternalTxnID: externalTxnID, Provider: provider, Status: model.FundingPending, FeeCents: feeCents}
+	err := s.DB.QueryRowContext(ctx,
+		`INSERT INTO deposits (user_id, asset, amount_cents, external_txn_id, provider, status, fee_cents)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)
+		 RETURNING id, created_at`,
+		userID, asset, amountCents, externalTxnID, provider, model.FundingPending, feeCents,
+	).Scan(&d.ID, &d.CreatedAt)
+	return d, err
+}
+
+// ConfirmDeposit settles a deposit inside tx: it looks the row up by the
+// (provider, externalTxnID) the provider's confirmation references,
+// credits the wallet, and appends an audit event, all in one crash-safe
+// transaction. A deposit already CONFIRMED is returned as-is rather than
+// credited twice, so a replayed webhook is a no-op.
+func (s *Store) ConfirmDeposit(tx *sql.Tx, provider, externalTxnID string) (*model.Deposit, error) {
+	d := &model.Deposit{}
+	err := tx.QueryRow(
+		`SELECT id, user_id, asset, amount_cents, external_txn_id, provider, status, fee_cents, created_at, confirmed_at
+		 FROM deposits WHERE provider=$1 AND external_txn_id=$2 FOR UPDATE`,
+		provider, externalTxnID,
+	).Scan(&d.ID, &d.UserID, &d.Asset, &d.AmountCents, &d.ExternalTxnID, &d.Provider, &d.Status, &d.FeeCents, &d.CreatedAt, &d.ConfirmedAt)
+	if err != nil {
+		return nil, err
+	}
+	if d.Status == model.FundingConfirmed {
+		return d, nil
+	}
+	if _, err := tx.Exec(`UPDATE deposits SET status=$1, confirmed_at=now() WHERE id=$2`, model.FundingConfirmed, d.ID); err != nil {
+		return nil, err
+	}
+	if err := WalletAddBalance(tx, d.UserID, d.AmountCents-d.FeeCents); err != nil {
+		return nil, err
+	}
+	if err := PublishEvent(tx, nil, model.TopicDepositConfirmed, model.DepositConfirmedPayload{
+		DepositID: d.ID, UserID: d.UserID, AmountCents: d.AmountCents, FeeCents: d.FeeCents,
+		Provider: provider, ExternalTxnID: externalTxnID,
+	}); err != nil {
+		return nil, err
+	}
+	d.Status = model.FundingConfirmed
+	now := time.Now()
+	d.ConfirmedAt = &now
+	return d, nil
+}
+
+// RequestWithdrawal records an outbound funds movement as PENDING and
+// locks amountCents+feeCents against the wallet so it can't also be
+// spent on a trade while the payout is in flight. The wallet's balance
+// itself isn't debited until the withdrawal settles — mirroring how
+// order collateral is locked, then released or consumed, elsewhere in
+// this package. Callers must hold the wallet's row lock (via
+// GetWalletForUpdate) before calling this.
+func (s *Store) RequestWithdrawal(tx *sql.Tx, userID, asset string, amountCents, feeCents int64, provider string) (*model.Withdrawal, error) {
+	total := amountCents + feeCents
+	if err := WalletAddLocked(tx, userID, total); err != nil {
+		return nil, err
+	}
+	wd := &model.Withdrawal{UserID: userID, Asset: asset, AmountCents: amountCents, Provider: provider, Status: model.FundingPending, FeeCents: feeCents}
+	err := tx.QueryRow(
+		`INSERT INTO withdrawals (user_id, asset, amount_cents, provider, status, fee_cents)
+		 VALUES ($1,$2,$3,$4,$5,$6)
+		 RETURNING id, created_at`,
+		userID, asset, amountCents, provider, model.FundingPending, feeCents,
+	).Scan(&wd.ID, &wd.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if err := PublishEvent(tx, nil, model.TopicWithdrawalRequested, model.WithdrawalEventPayload{
+		WithdrawalID: wd.ID, UserID: userID, AmountCents: amountCents, FeeCents: feeCents, Provider: provider,
+	}); err != nil {
+		return nil, err
+	}
+	return wd, nil
+}
+
+// SetWithdrawalExternalTxnID records the reference the provider handed
+// back after accepting the payout request. Run outside the requesting
+// transaction, since it happens after the provider call and the request
+// row is already committed.
+func (s *Store) SetWithdrawalExternalTxnID(ctx context.Context, withdrawalID, externalTxnID string) error {
+	_, err := s.DB.ExecContext(ctx, `UPDATE withdrawals SET external_txn_id=$1 WHERE id=$2`, externalTxnID, withdrawalID)
+	return err
+}
+
+// MarkWithdrawalSettled finalizes a withdrawal once the provider reports
+// the payout complete: it releases the lock and debits the balance in
+// the same transaction that flips the row to CONFIRMED and logs the
+// audit event, so the money actually leaves the wallet exactly once.
+func (s *Store) MarkWithdrawalSettled(tx *sql.Tx, withdrawalID string) (*model.Withdrawal, error) {
+	wd, err := lockWithdrawal(tx, withdrawalID)
+	if err != nil {
+		return nil, err
+	}
+	if wd.Status == model.FundingConfirmed {
+		return wd, nil
+	}
+	total := wd.AmountCents + wd.FeeCents
+	if _, err := tx.Exec(`UPDATE withdrawals SET status=$1, confirmed_at=now() WHERE id=$2`, model.FundingConfirmed, wd.ID); err != nil {
+		return nil, err
+	}
+	if err := WalletAddLocked(tx, wd.UserID, -total); err != nil {
+		return nil, err
+	}
+	if err := WalletAddBalance(tx, wd.UserID, -total); err != nil {
+		return nil, err
+	}
+	if err := PublishEvent(tx, nil, model.TopicWithdrawalSettled, model.WithdrawalEventPayload{
+		WithdrawalID: wd.ID, UserID: wd.UserID, AmountCents: wd.AmountCents, FeeCents: wd.FeeCents,
+	}); err != nil {
+		return nil, err
+	}
+	wd.Status = model.FundingConfirmed
+	now := time.Now()
+	wd.ConfirmedAt = &now
+	return wd, nil
+}
+
+// MarkWithdrawalFailed releases the lock without touching the balance,
+// so a rejected or bounced payout returns the funds to the user's
+// available balance untouched.
+func (s *Store) MarkWithdrawalFailed(tx *sql.Tx, withdrawalID string) (*model.Withdrawal, error) {
+	wd, err := lockWithdrawal(tx, withdrawalID)
+	if err != nil {
+		return nil, err
+	}
+	if wd.Status == model.FundingFailed {
+		return wd, nil
+	}
+	total := wd.AmountCents + wd.FeeCents
+	if _, err := tx.Exec(`UPDATE withdrawals SET status=$1 WHERE id=$2`, model.FundingFailed, wd.ID); err != nil {
+		return nil, err
+	}
+	if err := WalletAddLocked(tx, wd.UserID, -total); err != nil {
+		return nil, err
+	}
+	if err := PublishEvent(tx, nil, model.TopicWithdrawalFailed, model.WithdrawalEventPayload{
+		WithdrawalID: wd.ID, UserID: wd.UserID, AmountCents: wd.AmountCents, FeeCents: wd.FeeCents,
+	}); err != nil {
+		return nil, err
+	}
+	wd.Status = model.FundingFailed
+	return wd, nil
+}
+
+func lockWithdrawal(tx *sql.Tx, withdrawalID string) (*model.Withdrawal, error) {
+	wd := &model.Withdrawal{}
+	err := tx.QueryRow(
+		`SELECT id, user_id, asset, amount_cents, external_txn_id, provider, status, fee_cents, created_at, confirmed_at
+		 FROM withdrawals WHERE id=$1 FOR UPDATE`, withdrawalID,
+	).Scan(&wd.ID, &wd.UserID, &wd.Asset, &wd.AmountCents, &wd.ExternalTxnID, &wd.Provider, &wd.Status, &wd.FeeCents, &wd.CreatedAt, &wd.ConfirmedAt)
+	return wd, err
+}
+
+// ── API Keys ─────────────────────────────────────────
+
+func (s *Store) CreateAPIKey(ctx context.Context, userID, key, secretEnc string, perms []model.APIKeyPermission, ipAllowlist []string) (*model.APIKey, error) {
+	permsJSON, err := json.Marshal(perms)
+	if err != nil {
+		return nil, err
+	}
+	allowJSON, err := json.Marshal(ipAllowlist)
+	if err != nil {
+		return nil, err
+	}
+	k := &model.APIKey{}
+	err = s.DB.QueryRowContext(ctx,
+		`INSERT INTO api_keys (user_id, key, secret_enc, permissions, ip_allowlist)
+		 VALUES ($1,$2,$3,$4,$5)
+		 RETURNING id, user_id, key, secret_enc, created_at`,
+		userID, key, secretEnc, permsJSON, allowJSON,
+	).Scan(&k.ID, &k.UserID, &k.Key, &k.SecretEnc, &k.CreatedAt)
+	k.Permissions = perms
+	k.IPAllowlist = ipAllowlist
+	return k, err
+}
+
+func (s *Store) GetAPIKeyByKey(ctx context.Context, key string) (*model.APIKey, error) {
+	k := &model.APIKey{}
+	var permsJSON, allowJSON []byte
+	err := s.DB.QueryRowContext(ctx,
+		`SELECT id, user_id, key, secret_enc, permissions, ip_allowlist, created_at FROM api_keys WHERE key=$1`, key,
+	).Scan(&k.ID, &k.UserID, &k.Key, &k.SecretEnc, &permsJSON, &allowJSON, &k.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal(permsJSON, &k.Permissions)
+	_ = json.Unmarshal(allowJSON, &k.IPAllowlist)
+	return k, nil
+}
+
 // ── Markets ──────────────────────────────────────────
 
-func (s *Store) CreateMarket(ctx context.Context, slug, title, desc string, tick int) (*model.Market, error) {
+// CreateMarket creates a market with the given matching mode, fixed for the
+// lifetime of its engine. matchingMode defaults to CONTINUOUS when empty;
+// epochDurationMs is ignored outside EPOCH mode.
+func (s *Store) CreateMarket(ctx context.Context, slug, title, desc string, tick int, matchingMode model.MatchingMode, epochDurationMs int) (*model.Market, error) {
+	if matchingMode == "" {
+		matchingMode = model.ModeContinuous
+	}
+	instrJSON, err := json.Marshal(defaultInstrument(tick))
+	if err != nil {
+		return nil, err
+	}
 	m := &model.Market{}
-	err := s.DB.QueryRowContext(ctx,
-		`INSERT INTO markets (slug,title,description,tick_size_cents)
-		 VALUES ($1,$2,$3,$4)
-		 RETURNING id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at`,
-		slug, title, desc, tick,
-	).Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt)
-	return m, err
+	var instrRaw []byte
+	err = s.DB.QueryRowContext(ctx,
+		`INSERT INTO markets (slug,title,description,tick_size_cents,instrument_json,matching_mode,epoch_duration_ms)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)
+		 RETURNING id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at,instrument_json,matching_mode,epoch_duration_ms,suspend_at,suspend_purge`,
+		slug, title, desc, tick, instrJSON, matchingMode, epochDurationMs,
+	).Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt, &instrRaw, &m.MatchingMode, &m.EpochDurationMs, &m.SuspendAt, &m.SuspendPurge)
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal(instrRaw, &m.Instrument)
+	return m, nil
+}
+
+// defaultInstrument seeds a new market's instrument metadata from its
+// tick size, matching the 1-99/qty>=1 limits the engine enforced before
+// per-market instrument metadata existed.
+func defaultInstrument(tick int) model.Instrument {
+	instr := model.DefaultInstrument()
+	if tick > 0 {
+		instr.PriceTickCents = tick
+	}
+	return instr
 }
 
 func (s *Store) ListMarkets(ctx context.Context) ([]model.Market, error) {
 	rows, err := s.DB.QueryContext(ctx,
-		`SELECT id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at
+		`SELECT id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at,instrument_json,matching_mode,epoch_duration_ms,suspend_at,suspend_purge
 		 FROM markets ORDER BY created_at DESC`)
 	if err != nil {
 		return nil, err
@@ -184,9 +445,11 @@ func (s *Store) ListMarkets(ctx context.Context) ([]model.Market, error) {
 	var out []model.Market
 	for rows.Next() {
 		var m model.Market
-		if err := rows.Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt); err != nil {
+		var instrRaw []byte
+		if err := rows.Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt, &instrRaw, &m.MatchingMode, &m.EpochDurationMs, &m.SuspendAt, &m.SuspendPurge); err != nil {
 			return nil, err
 		}
+		_ = json.Unmarshal(instrRaw, &m.Instrument)
 		out = append(out, m)
 	}
 	return out, nil
@@ -194,20 +457,29 @@ func (s *Store) ListMarkets(ctx context.Context) ([]model.Market, error) {
 
 func (s *Store) GetMarket(ctx context.Context, id string) (*model.Market, error) {
 	m := &model.Market{}
+	var instrRaw []byte
 	err := s.DB.QueryRowContext(ctx,
-		`SELECT id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at
+		`SELECT id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at,instrument_json,matching_mode,epoch_duration_ms,suspend_at,suspend_purge
 		 FROM markets WHERE id=$1`, id,
-	).Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt)
+	).Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt, &instrRaw, &m.MatchingMode, &m.EpochDurationMs, &m.SuspendAt, &m.SuspendPurge)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
-	return m, err
+	if err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal(instrRaw, &m.Instrument)
+	return m, nil
 }
 
+// GetOpenMarkets returns every market Boot should start an engine for:
+// OPEN markets as always, plus SUSPENDED ones so their book stays in
+// memory and a pending scheduled suspension (or its resume) keeps working
+// across a restart. RESOLVED markets are excluded — they never run again.
 func (s *Store) GetOpenMarkets(ctx context.Context) ([]model.Market, error) {
 	rows, err := s.DB.QueryContext(ctx,
-		`SELECT id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at
-		 FROM markets WHERE status='OPEN'`)
+		`SELECT id,slug,title,description,status,resolves_to,tick_size_cents,created_at,resolved_at,instrument_json,matching_mode,epoch_duration_ms,suspend_at,suspend_purge
+		 FROM markets WHERE status IN ('OPEN','SUSPENDED')`)
 	if err != nil {
 		return nil, err
 	}
@@ -215,25 +487,100 @@ func (s *Store) GetOpenMarkets(ctx context.Context) ([]model.Market, error) {
 	var out []model.Market
 	for rows.Next() {
 		var m model.Market
-		if err := rows.Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt); err != nil {
+		var instrRaw []byte
+		if err := rows.Scan(&m.ID, &m.Slug, &m.Title, &m.Description, &m.Status, &m.ResolvesTo, &m.TickSizeCents, &m.CreatedAt, &m.ResolvedAt, &instrRaw, &m.MatchingMode, &m.EpochDurationMs, &m.SuspendAt, &m.SuspendPurge); err != nil {
 			return nil, err
 		}
+		_ = json.Unmarshal(instrRaw, &m.Instrument)
 		out = append(out, m)
 	}
 	return out, nil
 }
 
+// UpdateMarketInstrument persists admin-edited instrument metadata within
+// an in-flight transaction, so it lands atomically alongside its audit event.
+func UpdateMarketInstrument(tx *sql.Tx, marketID string, instr model.Instrument) error {
+	instrJSON, err := json.Marshal(instr)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE markets SET instrument_json=$1 WHERE id=$2`, instrJSON, marketID)
+	return err
+}
+
+// ScheduleMarketSuspension persists a pending suspension for a market
+// without changing its status yet, so the schedule (and whether it
+// should purge the book once it fires) survives a restart before
+// suspendAt arrives.
+func ScheduleMarketSuspension(tx *sql.Tx, marketID string, suspendAt time.Time, purge bool) error {
+	_, err := tx.Exec(`UPDATE markets SET suspend_at=$1, suspend_purge=$2 WHERE id=$3`, suspendAt, purge, marketID)
+	return err
+}
+
+// SuspendMarketNow takes a suspension into effect: the market's status
+// flips to SUSPENDED and its pending-schedule fields are cleared since
+// they've now been consumed.
+func SuspendMarketNow(tx *sql.Tx, marketID string) error {
+	_, err := tx.Exec(`UPDATE markets SET status='SUSPENDED', suspend_at=NULL, suspend_purge=false WHERE id=$1`, marketID)
+	return err
+}
+
+// ResumeMarket re-opens a suspended market and clears any pending
+// suspension schedule along with it.
+func ResumeMarket(tx *sql.Tx, marketID string) error {
+	_, err := tx.Exec(`UPDATE markets SET status='OPEN', suspend_at=NULL, suspend_purge=false WHERE id=$1`, marketID)
+	return err
+}
+
+// InsertEpoch persists one completed EPOCH-mode batch auction round, so
+// clients can later verify the fairness of its random tie-break against
+// the recorded seed and participating-order-id hash.
+func InsertEpoch(tx *sql.Tx, ep *model.Epoch) error {
+	_, err := tx.Exec(
+		`INSERT INTO epochs (id,market_id,seed,clearing_cents,matched_qty,order_ids_hash,started_at,ended_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		ep.ID, ep.MarketID, ep.Seed, ep.ClearingCents, ep.MatchedQty, ep.OrderIDsHash, ep.StartedAt, ep.EndedAt,
+	)
+	return err
+}
+
 // ── Orders ───────────────────────────────────────────
 
 func InsertOrder(tx *sql.Tx, o *model.Order) error {
 	_, err := tx.Exec(
-		`INSERT INTO orders (id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id)
-		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
-		o.ID, o.MarketID, o.UserID, o.Side, o.OrderType, o.PriceCents, o.Qty, o.RemainingQty, o.LockedCents, o.Status, o.Seq, o.ClientOrderID,
+		`INSERT INTO orders (id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,time_in_force,post_only,expires_at)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15)`,
+		o.ID, o.MarketID, o.UserID, o.Side, o.OrderType, o.PriceCents, o.Qty, o.RemainingQty, o.LockedCents, o.Status, o.Seq, o.ClientOrderID, o.TimeInForce, o.PostOnly, o.ExpiresAt,
 	)
 	return err
 }
 
+// BatchInsertOrders inserts every order in one multi-VALUES statement
+// instead of one round trip per order, for callers (processBatch's
+// market-maker ladders) that build several independent order rows up
+// front. It is a straight batch of InsertOrder's single-row statement;
+// callers needing the rows in a particular order must rely on the orders'
+// own Seq column, not insertion order.
+func BatchInsertOrders(tx *sql.Tx, orders []*model.Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	sb.WriteString(`INSERT INTO orders (id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,time_in_force,post_only,expires_at) VALUES `)
+	args := make([]any, 0, len(orders)*15)
+	for i, o := range orders {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		base := i * 15
+		fmt.Fprintf(&sb, "($%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d,$%d)",
+			base+1, base+2, base+3, base+4, base+5, base+6, base+7, base+8, base+9, base+10, base+11, base+12, base+13, base+14, base+15)
+		args = append(args, o.ID, o.MarketID, o.UserID, o.Side, o.OrderType, o.PriceCents, o.Qty, o.RemainingQty, o.LockedCents, o.Status, o.Seq, o.ClientOrderID, o.TimeInForce, o.PostOnly, o.ExpiresAt)
+	}
+	_, err := tx.Exec(sb.String(), args...)
+	return err
+}
+
 func UpdateOrderFill(tx *sql.Tx, orderID string, remainingQty int, lockedCents int64, status model.OrderStatus) error {
 	_, err := tx.Exec(
 		`UPDATE orders SET remaining_qty=$1, locked_cents=$2, status=$3, updated_at=now() WHERE id=$4`,
@@ -244,7 +591,7 @@ func UpdateOrderFill(tx *sql.Tx, orderID string, remainingQty int, lockedCents i
 
 func (s *Store) GetOpenOrders(ctx context.Context, marketID string) ([]model.Order, error) {
 	rows, err := s.DB.QueryContext(ctx,
-		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,created_at,updated_at
+		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,time_in_force,post_only,expires_at,created_at,updated_at
 		 FROM orders WHERE market_id=$1 AND status IN ('OPEN','PARTIAL') ORDER BY seq`, marketID)
 	if err != nil {
 		return nil, err
@@ -253,9 +600,25 @@ func (s *Store) GetOpenOrders(ctx context.Context, marketID string) ([]model.Ord
 	return scanOrders(rows)
 }
 
+// GetOrdersSince returns every order for marketID with seq greater than
+// sinceSeq, regardless of status. newMarketEngine uses it to reconcile a
+// restored market_snapshots row against whatever changed after it was
+// taken (new resting orders to add, filled/canceled ones to remove)
+// without rescanning the market's full order history.
+func (s *Store) GetOrdersSince(ctx context.Context, marketID string, sinceSeq int64) ([]model.Order, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,time_in_force,post_only,expires_at,created_at,updated_at
+		 FROM orders WHERE market_id=$1 AND seq>$2 ORDER BY seq`, marketID, sinceSeq)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanOrders(rows)
+}
+
 func (s *Store) GetUserOrders(ctx context.Context, marketID, userID string) ([]model.Order, error) {
 	rows, err := s.DB.QueryContext(ctx,
-		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,created_at,updated_at
+		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,time_in_force,post_only,expires_at,created_at,updated_at
 		 FROM orders WHERE market_id=$1 AND user_id=$2 ORDER BY created_at DESC LIMIT 100`, marketID, userID)
 	if err != nil {
 		return nil, err
@@ -266,10 +629,27 @@ func (s *Store) GetUserOrders(ctx context.Context, marketID, userID string) ([]m
 
 func (s *Store) GetOrder(ctx context.Context, id string) (*model.Order, error) {
 	row := s.DB.QueryRowContext(ctx,
-		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,created_at,updated_at
+		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,time_in_force,post_only,expires_at,created_at,updated_at
 		 FROM orders WHERE id=$1`, id)
 	o := &model.Order{}
-	err := row.Scan(&o.ID, &o.MarketID, &o.UserID, &o.Side, &o.OrderType, &o.PriceCents, &o.Qty, &o.RemainingQty, &o.LockedCents, &o.Status, &o.Seq, &o.ClientOrderID, &o.CreatedAt, &o.UpdatedAt)
+	err := row.Scan(&o.ID, &o.MarketID, &o.UserID, &o.Side, &o.OrderType, &o.PriceCents, &o.Qty, &o.RemainingQty, &o.LockedCents, &o.Status, &o.Seq, &o.ClientOrderID, &o.TimeInForce, &o.PostOnly, &o.ExpiresAt, &o.CreatedAt, &o.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return o, err
+}
+
+// GetOrderByClientID looks up an order by the caller-supplied idempotency
+// key, scoped to the market and user that submitted it. It backs
+// Manager.PlaceOrderWithRetry's dedup check and relies on an unmigrated
+// unique index orders_client_idx on (market_id, user_id, client_order_id)
+// to make concurrent retries of the same key race-safe.
+func (s *Store) GetOrderByClientID(ctx context.Context, marketID, userID, clientOrderID string) (*model.Order, error) {
+	row := s.DB.QueryRowContext(ctx,
+		`SELECT id,market_id,user_id,side,order_type,price_cents,qty,remaining_qty,locked_cents,status,seq,client_order_id,time_in_force,post_only,expires_at,created_at,updated_at
+		 FROM orders WHERE market_id=$1 AND user_id=$2 AND client_order_id=$3`, marketID, userID, clientOrderID)
+	o := &model.Order{}
+	err := row.Scan(&o.ID, &o.MarketID, &o.UserID, &o.Side, &o.OrderType, &o.PriceCents, &o.Qty, &o.RemainingQty, &o.LockedCents, &o.Status, &o.Seq, &o.ClientOrderID, &o.TimeInForce, &o.PostOnly, &o.ExpiresAt, &o.CreatedAt, &o.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -288,11 +668,69 @@ func (s *Store) MaxSeq(ctx context.Context, marketID string) (int64, error) {
 	return seq, err
 }
 
+// MaxSeqSince is MaxSeq scoped to rows newer than sinceSeq, so a boot that
+// already has a market_snapshots row only scans the delta since it was
+// taken instead of the market's full order/trade/event history.
+func (s *Store) MaxSeqSince(ctx context.Context, marketID string, sinceSeq int64) (int64, error) {
+	var seq int64
+	err := s.DB.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(seq), $2) FROM (
+			SELECT seq FROM orders WHERE market_id=$1 AND seq > $2
+			UNION ALL SELECT seq FROM trades WHERE market_id=$1 AND seq > $2
+			UNION ALL SELECT seq FROM event_log WHERE market_id=$1 AND seq IS NOT NULL AND seq > $2
+		 ) t`, marketID, sinceSeq,
+	).Scan(&seq)
+	return seq, err
+}
+
+// ── Market Snapshots ──────────────────────────────────
+//
+// market_snapshots is unmigrated, snapshot-only, the same as event_outbox
+// and the deposits/withdrawals tables above: no migrations/ directory
+// exists in this tree, so this documents the schema a real migration
+// would add.
+//
+// CREATE TABLE market_snapshots (
+//     id                 BIGSERIAL PRIMARY KEY,
+//     market_id          TEXT NOT NULL REFERENCES markets(id),
+//     seq                BIGINT NOT NULL,
+//     book_json          JSONB NOT NULL,
+//     positions_json     JSONB NOT NULL,
+//     platform_fee_cents BIGINT NOT NULL,
+//     created_at         TIMESTAMPTZ NOT NULL DEFAULT now()
+// );
+// CREATE INDEX market_snapshots_market_seq_idx ON market_snapshots (market_id, seq DESC);
+
+// SaveSnapshot records a point-in-time capture of a market's book and
+// positions, tagged with seq so a later boot knows how much history it
+// can skip replaying.
+func SaveSnapshot(tx *sql.Tx, marketID string, seq int64, bookJSON, positionsJSON []byte, platformFeeCents int64) error {
+	_, err := tx.Exec(
+		`INSERT INTO market_snapshots (market_id, seq, book_json, positions_json, platform_fee_cents) VALUES ($1,$2,$3,$4,$5)`,
+		marketID, seq, bookJSON, positionsJSON, platformFeeCents,
+	)
+	return err
+}
+
+// LatestSnapshot returns marketID's newest snapshot, or nil if none has
+// been taken yet.
+func (s *Store) LatestSnapshot(ctx context.Context, marketID string) (*model.MarketSnapshot, error) {
+	row := s.DB.QueryRowContext(ctx,
+		`SELECT market_id, seq, book_json, positions_json, platform_fee_cents, created_at
+		 FROM market_snapshots WHERE market_id=$1 ORDER BY seq DESC LIMIT 1`, marketID)
+	snap := &model.MarketSnapshot{}
+	err := row.Scan(&snap.MarketID, &snap.Seq, &snap.BookJSON, &snap.PositionsJSON, &snap.PlatformFeeCents, &snap.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return snap, err
+}
+
 func scanOrders(rows *sql.Rows) ([]model.Order, error) {
 	var out []model.Order
 	for rows.Next() {
 		var o model.Order
-		if err := rows.Scan(&o.ID, &o.MarketID, &o.UserID, &o.Side, &o.OrderType, &o.PriceCents, &o.Qty, &o.RemainingQty, &o.LockedCents, &o.Status, &o.Seq, &o.ClientOrderID, &o.CreatedAt, &o.UpdatedAt); err != nil {
+		if err := rows.Scan(&o.ID, &o.MarketID, &o.UserID, &o.Side, &o.OrderType, &o.PriceCents, &o.Qty, &o.RemainingQty, &o.LockedCents, &o.Status, &o.Seq, &o.ClientOrderID, &o.TimeInForce, &o.PostOnly, &o.ExpiresAt, &o.CreatedAt, &o.UpdatedAt); err != nil {
 			return nil, err
 		}
 		out = append(out, o)
@@ -330,6 +768,29 @@ func (s *Store) ListTrades(ctx context.Context, marketID string, limit int) ([]m
 	return out, nil
 }
 
+// GetTradesForOrder returns every trade an order participated in, as
+// either maker or taker, ordered the way they occurred. Used alongside
+// GetOrderByClientID so a retried PlaceOrderWithRetry call can report the
+// fills of the original attempt instead of re-submitting it.
+func (s *Store) GetTradesForOrder(ctx context.Context, orderID string) ([]model.Trade, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT id,market_id,maker_order_id,taker_order_id,maker_user_id,taker_user_id,price_cents,qty,fee_cents,seq,created_at
+		 FROM trades WHERE maker_order_id=$1 OR taker_order_id=$1 ORDER BY seq`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Trade
+	for rows.Next() {
+		var t model.Trade
+		if err := rows.Scan(&t.ID, &t.MarketID, &t.MakerOrderID, &t.TakerOrderID, &t.MakerUserID, &t.TakerUserID, &t.PriceCents, &t.Qty, &t.FeeCents, &t.Seq, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
 // ── Positions ────────────────────────────────────────
 
 func UpsertPosition(tx *sql.Tx, marketID, userID string, sharesDelta int) error {
@@ -341,6 +802,35 @@ func UpsertPosition(tx *sql.Tx, marketID, userID string, sharesDelta int) error
 	return err
 }
 
+// GetPositionsForUpdate locks and returns a user's positions across a set
+// of markets hedged against the one they're trading in, so an order's
+// collateral discount (model.CalcLockWithHedge) is computed against a
+// consistent snapshot that can't change out from under the same tx's
+// wallet lock.
+func (s *Store) GetPositionsForUpdate(tx *sql.Tx, userID string, marketIDs []string) ([]model.Position, error) {
+	if len(marketIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := tx.Query(
+		`SELECT id,market_id,user_id,yes_shares,avg_cost_cents,realized_pnl_cents
+		 FROM positions WHERE user_id=$1 AND market_id = ANY($2) FOR UPDATE`,
+		userID, pq.Array(marketIDs),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Position
+	for rows.Next() {
+		var p model.Position
+		if err := rows.Scan(&p.ID, &p.MarketID, &p.UserID, &p.YesShares, &p.AvgCostCents, &p.RealizedPnlCents); err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
 func (s *Store) ListPositions(ctx context.Context, marketID string) ([]model.Position, error) {
 	rows, err := s.DB.QueryContext(ctx,
 		`SELECT id,market_id,user_id,yes_shares,avg_cost_cents,realized_pnl_cents FROM positions WHERE market_id=$1`, marketID)
@@ -359,7 +849,48 @@ func (s *Store) ListPositions(ctx context.Context, marketID string) ([]model.Pos
 	return out, nil
 }
 
+// ── Klines ───────────────────────────────────────────
+
+func UpsertKline(tx *sql.Tx, k *model.Kline) error {
+	_, err := tx.Exec(
+		`INSERT INTO klines (market_id,interval,open_time,close_time,open_cents,high_cents,low_cents,close_cents,volume,trade_count)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
+		 ON CONFLICT (market_id,interval,open_time) DO UPDATE SET
+		   high_cents=GREATEST(klines.high_cents,$6), low_cents=LEAST(klines.low_cents,$7),
+		   close_cents=$8, volume=klines.volume+$9, trade_count=klines.trade_count+$10`,
+		k.MarketID, k.Interval, k.OpenTime, k.CloseTime, k.Open, k.High, k.Low, k.Close, k.Volume, k.TradeCount,
+	)
+	return err
+}
+
+func (s *Store) ListKlines(ctx context.Context, marketID, interval string, start, end time.Time, limit int) ([]model.Kline, error) {
+	rows, err := s.DB.QueryContext(ctx,
+		`SELECT market_id,interval,open_time,close_time,open_cents,high_cents,low_cents,close_cents,volume,trade_count
+		 FROM klines WHERE market_id=$1 AND interval=$2 AND open_time >= $3 AND open_time < $4
+		 ORDER BY open_time ASC LIMIT $5`, marketID, interval, start, end, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []model.Kline
+	for rows.Next() {
+		var k model.Kline
+		if err := rows.Scan(&k.MarketID, &k.Interval, &k.OpenTime, &k.CloseTime, &k.Open, &k.High, &k.Low, &k.Close, &k.Volume, &k.TradeCount); err != nil {
+			return nil, err
+		}
+		k.Closed = true
+		out = append(out, k)
+	}
+	return out, nil
+}
+
 // ── Event Log ────────────────────────────────────────
+//
+// AppendEvent remains the general-purpose, untyped event log: every
+// in-engine event that doesn't yet have a model.Topic still flows
+// through it. Events a subscriber needs to filter by topic (see
+// outbox.go's PublishEvent) are migrated to event_outbox one Topic at a
+// time rather than all at once, so each migration stays reviewable.
 
 func AppendEvent(tx *sql.Tx, marketID *string, seq *int64, evType string, payload any) error {
 	b, err := json.Marshal(payload)
@@ -422,14 +953,18 @@ func ResolveMarket(tx *sql.Tx, marketID, resolvesTo string) error {
 	return err
 }
 
+// CancelOrderTx cancels orderID and returns the locked_cents it held just
+// before cancellation, so the caller can release that amount via
+// WalletAddLocked. The pre-update value is captured in a CTE before the
+// UPDATE zeroes locked_cents — reading it back via RETURNING on the same
+// UPDATE would always come back 0, since the UPDATE is what zeroes it.
 func CancelOrderTx(tx *sql.Tx, orderID string) (int64, error) {
 	var locked int64
 	err := tx.QueryRow(
-		`UPDATE orders SET status='CANCELED', remaining_qty=0, locked_cents=0, updated_at=now()
-		 WHERE id=$1 RETURNING locked_cents`, orderID,
+		`WITH prior AS (SELECT locked_cents FROM orders WHERE id=$1)
+		 UPDATE orders SET status='CANCELED', remaining_qty=0, locked_cents=0, updated_at=now()
+		 WHERE id=$1 RETURNING (SELECT locked_cents FROM prior)`, orderID,
 	).Scan(&locked)
-	// locked is the OLD value before zeroing — but we zeroed it. Need a different approach.
-	// Re-query first:
 	return locked, err
 }
 
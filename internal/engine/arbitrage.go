@@ -0,0 +1,376 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"wager-exchange/internal/model"
+	"wager-exchange/internal/store"
+)
+
+// ArbLeg is one market/direction pair in a triangular arbitrage path.
+// Direction is the side the arbitrator trades to go around the cycle.
+type ArbLeg struct {
+	MarketID  string
+	Direction model.OrderSide
+}
+
+// ArbPath is a user-configured cycle of three markets believed to be
+// synthetically related (e.g. YES on A, YES on B, and "A implies B" on C).
+type ArbPath struct {
+	ID   string
+	Legs [3]ArbLeg
+}
+
+// ArbOpportunity is one scan's result for a path: the round-trip ratio,
+// the size it's available at, and (after Scan executes it) the outcome.
+type ArbOpportunity struct {
+	PathID     string    `json:"path_id"`
+	Ratio      float64   `json:"ratio"`
+	Qty        int       `json:"qty"`
+	DetectedAt time.Time `json:"detected_at"`
+	Executed   bool      `json:"executed"`
+	FailedLeg  int       `json:"failed_leg,omitempty"`
+}
+
+// placedLeg records a successfully-placed leg so execute can unwind it if
+// a later leg in the same cycle fails. qty is how much actually filled
+// (an IOC leg can partial-fill), not the leg's requested size, since
+// that's what needs flattening.
+type placedLeg struct {
+	marketID  string
+	orderID   string
+	direction model.OrderSide
+	qty       int
+	eng       *MarketEngine
+}
+
+// filledQty sums the quantity actually crossed by a PlaceOrder call.
+func filledQty(r model.PlaceOrderResult) int {
+	q := 0
+	for _, t := range r.Trades {
+		q += t.Qty
+	}
+	return q
+}
+
+// TriangularArbitrator watches a set of user-configured ArbPaths and, when
+// the round-trip price ratio across their three markets exceeds
+// minSpreadRatio net of fees, fires three atomic taker legs sized to the
+// smallest touched level and priced as marketable limits widened by a
+// protective slippageRatio, rolling back any legs already filled if a
+// later leg fails.
+//
+// The round-trip ratio for path [m1,m2,m3] with directions [d1,d2,d3] is
+// price(m1,-d1) * price(m2,-d2) * price(m3,-d3), where price(m,d) is the
+// top-of-book quote a taker order of side d would cross at. Using the
+// opposite side of each leg's configured direction gives a conservative
+// read on whether the cycle is profitable before any capital moves;
+// execution itself trades each leg in its configured direction.
+type TriangularArbitrator struct {
+	manager *Manager
+	store   store.Store
+
+	mu    sync.Mutex
+	paths map[string]ArbPath
+
+	minSpreadRatio float64
+	slippageRatio  float64
+	feeBps         int
+
+	exposureCapCents  map[string]int64 // per-market notional cap
+	exposureUsedCents map[string]int64 // per-market notional currently committed
+
+	active []ArbOpportunity // last scan's profitable paths, ranked by ratio descending
+}
+
+// NewTriangularArbitrator builds an arbitrator that executes through manager
+// and logs detected/executed cycles via store. minSpreadRatio is the
+// round-trip ratio threshold to act on (e.g. 1.001); slippageRatio widens
+// each leg's marketable-limit price to absorb book movement between the
+// scan and the order landing.
+func NewTriangularArbitrator(manager *Manager, store store.Store, feeBps int, minSpreadRatio, slippageRatio float64) *TriangularArbitrator {
+	return &TriangularArbitrator{
+		manager:           manager,
+		store:             store,
+		paths:             make(map[string]ArbPath),
+		minSpreadRatio:    minSpreadRatio,
+		slippageRatio:     slippageRatio,
+		feeBps:            feeBps,
+		exposureCapCents:  make(map[string]int64),
+		exposureUsedCents: make(map[string]int64),
+	}
+}
+
+// RegisterPath adds a path to scan. exposureCapCents bounds the notional
+// this arbitrator may have outstanding on any one of the path's markets at
+// once (first registration for a market wins; later paths sharing that
+// market reuse the existing cap).
+func (a *TriangularArbitrator) RegisterPath(path ArbPath, exposureCapCents int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.paths[path.ID] = path
+	for _, leg := range path.Legs {
+		if _, ok := a.exposureCapCents[leg.MarketID]; !ok {
+			a.exposureCapCents[leg.MarketID] = exposureCapCents
+		}
+	}
+}
+
+// ActivePaths returns the ranked queue of profitable paths from the most
+// recent Scan, highest ratio first.
+func (a *TriangularArbitrator) ActivePaths() []ArbOpportunity {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	out := make([]ArbOpportunity, len(a.active))
+	copy(out, a.active)
+	return out
+}
+
+// Scan evaluates every registered path once, ranks any currently-profitable
+// ones by ratio descending, and executes them best-first as userID — since
+// executing one cycle can move the books the next depends on, order matters.
+func (a *TriangularArbitrator) Scan(userID string) []ArbOpportunity {
+	a.mu.Lock()
+	paths := make([]ArbPath, 0, len(a.paths))
+	for _, p := range a.paths {
+		paths = append(paths, p)
+	}
+	a.mu.Unlock()
+
+	var opportunities []ArbOpportunity
+	for _, p := range paths {
+		if opp, ok := a.evaluate(p); ok {
+			opportunities = append(opportunities, opp)
+		}
+	}
+	sort.Slice(opportunities, func(i, j int) bool { return opportunities[i].Ratio > opportunities[j].Ratio })
+
+	a.mu.Lock()
+	a.active = opportunities
+	a.mu.Unlock()
+
+	for i := range opportunities {
+		a.logEvent(opportunities[i].PathID, "ArbOpportunityDetected", opportunities[i])
+		a.execute(userID, &opportunities[i])
+	}
+	return opportunities
+}
+
+// oppositeSide flips BUY/SELL, used to read the conservative reference
+// quote for a leg's round-trip ratio.
+func oppositeSide(s model.OrderSide) model.OrderSide {
+	if s == model.SideBuy {
+		return model.SideSell
+	}
+	return model.SideBuy
+}
+
+// topOfBook returns the price and available qty a taker order of side
+// would cross at: the best ask for BUY, the best bid for SELL.
+func (a *TriangularArbitrator) topOfBook(marketID string, side model.OrderSide) (priceCents, qty int, ok bool) {
+	eng := a.manager.GetEngine(marketID)
+	if eng == nil {
+		return 0, 0, false
+	}
+	bids, asks := eng.book.Snapshot(1)
+	if side == model.SideBuy {
+		if len(asks) == 0 {
+			return 0, 0, false
+		}
+		return asks[0].Price, asks[0].Qty, true
+	}
+	if len(bids) == 0 {
+		return 0, 0, false
+	}
+	return bids[0].Price, bids[0].Qty, true
+}
+
+// evaluate computes a path's round-trip ratio and the largest size it's
+// available at, the smallest touched level's qty across all three legs.
+func (a *TriangularArbitrator) evaluate(p ArbPath) (ArbOpportunity, bool) {
+	ratio := 1.0
+	minQty := -1
+	for _, leg := range p.Legs {
+		priceCents, qty, ok := a.topOfBook(leg.MarketID, oppositeSide(leg.Direction))
+		if !ok || priceCents <= 0 {
+			return ArbOpportunity{}, false
+		}
+		ratio *= float64(priceCents) / 100.0
+		if minQty == -1 || qty < minQty {
+			minQty = qty
+		}
+	}
+	// Each of the three taker legs pays feeBps of its notional.
+	keep := 1 - float64(a.feeBps)/10000
+	if minQty <= 0 || ratio*keep*keep*keep <= a.minSpreadRatio {
+		return ArbOpportunity{}, false
+	}
+	return ArbOpportunity{PathID: p.ID, Ratio: ratio, Qty: minQty, DetectedAt: time.Now()}, true
+}
+
+// slippageAdjust widens a reference price into a marketable limit: a BUY
+// leg is willing to pay up to slippageRatio more, a SELL leg down to
+// slippageRatio less, clamped to the 1-99c tradable range.
+func slippageAdjust(priceCents int, side model.OrderSide, slippageRatio float64) int {
+	adj := float64(priceCents) * slippageRatio
+	p := priceCents
+	if side == model.SideBuy {
+		p = int(adj)
+		if p < priceCents {
+			p = priceCents
+		}
+	} else {
+		p = priceCents - int(adj-float64(priceCents))
+		if p > priceCents {
+			p = priceCents
+		}
+	}
+	if p < 1 {
+		p = 1
+	}
+	if p > 99 {
+		p = 99
+	}
+	return p
+}
+
+// reserveExposure admits a leg's notional against its market's exposure
+// cap, returning false (without reserving anything) if it would be
+// exceeded.
+func (a *TriangularArbitrator) reserveExposure(marketID string, notionalCents int64) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	capCents := a.exposureCapCents[marketID]
+	if capCents > 0 && a.exposureUsedCents[marketID]+notionalCents > capCents {
+		return false
+	}
+	a.exposureUsedCents[marketID] += notionalCents
+	return true
+}
+
+func (a *TriangularArbitrator) releaseExposure(marketID string, notionalCents int64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.exposureUsedCents[marketID] -= notionalCents
+}
+
+// execute places one IOC taker leg per market in the path, in the path's
+// configured directions, sized to opp.Qty at a slippage-adjusted
+// marketable limit price. If a leg fails, every already-filled leg in
+// this cycle is unwound with an opposing IOC trade sized to what actually
+// filled: every leg here runs TIFIOC, which never rests, so CancelOrder
+// is a no-op against it once it's filled — the only way to flatten a
+// filled leg is to trade back out of it, not cancel it.
+func (a *TriangularArbitrator) execute(userID string, opp *ArbOpportunity) {
+	a.mu.Lock()
+	p, ok := a.paths[opp.PathID]
+	a.mu.Unlock()
+	if !ok || opp.Qty <= 0 {
+		return
+	}
+
+	var placed []placedLeg
+	rollback := func(failedLeg int) {
+		for i := len(placed) - 1; i >= 0; i-- {
+			a.unwindLeg(userID, placed[i])
+		}
+		opp.FailedLeg = failedLeg
+		a.logEvent(p.ID, "ArbCycleRolledBack", *opp)
+	}
+
+	for i, leg := range p.Legs {
+		eng := a.manager.GetEngine(leg.MarketID)
+		if eng == nil {
+			rollback(i + 1)
+			return
+		}
+		priceCents, _, ok := a.topOfBook(leg.MarketID, leg.Direction)
+		if !ok {
+			rollback(i + 1)
+			return
+		}
+		marketablePrice := slippageAdjust(priceCents, leg.Direction, a.slippageRatio)
+		notional := int64(marketablePrice) * int64(opp.Qty)
+		if !a.reserveExposure(leg.MarketID, notional) {
+			rollback(i + 1)
+			return
+		}
+
+		result := eng.PlaceOrder(userID, model.PlaceOrderReq{
+			Side:        leg.Direction,
+			Type:        model.TypeLimit,
+			PriceCents:  &marketablePrice,
+			Qty:         opp.Qty,
+			TimeInForce: model.TIFIOC,
+		})
+		if result.Status == model.StatusRejected || len(result.Trades) == 0 {
+			a.releaseExposure(leg.MarketID, notional)
+			rollback(i + 1)
+			return
+		}
+		placed = append(placed, placedLeg{
+			marketID:  leg.MarketID,
+			orderID:   result.OrderID,
+			direction: leg.Direction,
+			qty:       filledQty(result),
+			eng:       eng,
+		})
+	}
+
+	opp.Executed = true
+	a.logEvent(p.ID, "ArbCycleExecuted", *opp)
+}
+
+// unwindLeg best-effort flattens an already-filled IOC leg by trading back
+// out of it: an opposite-direction IOC order for the same qty that
+// filled. This can itself fail to fully fill if the book has thinned out
+// since the original leg traded, in which case some exposure is left
+// outstanding and logged rather than silently dropped.
+func (a *TriangularArbitrator) unwindLeg(userID string, pl placedLeg) {
+	reverseSide := oppositeSide(pl.direction)
+	priceCents, _, ok := a.topOfBook(pl.marketID, reverseSide)
+	if !ok {
+		log.Printf("[arbitrage] unwind %s: no liquidity to flatten %d shares", pl.marketID, pl.qty)
+		return
+	}
+	marketablePrice := slippageAdjust(priceCents, reverseSide, a.slippageRatio)
+	result := pl.eng.PlaceOrder(userID, model.PlaceOrderReq{
+		Side:        reverseSide,
+		Type:        model.TypeLimit,
+		PriceCents:  &marketablePrice,
+		Qty:         pl.qty,
+		TimeInForce: model.TIFIOC,
+	})
+	a.releaseExposure(pl.marketID, int64(marketablePrice)*int64(pl.qty))
+	if filled := filledQty(result); filled < pl.qty {
+		log.Printf("[arbitrage] unwind %s: only flattened %d/%d shares, %d still exposed",
+			pl.marketID, filled, pl.qty, pl.qty-filled)
+	}
+}
+
+// logEvent records a detected or executed arbitrage cycle in its own
+// short transaction, since a cycle spans three markets and has no single
+// market transaction to ride along with.
+func (a *TriangularArbitrator) logEvent(pathID, evType string, opp ArbOpportunity) {
+	ctx := context.Background()
+	tx, err := a.store.BeginTx(ctx)
+	if err != nil {
+		log.Printf("[arbitrage] path %s: %s event failed: %v", pathID, evType, err)
+		return
+	}
+	defer tx.Rollback()
+	if err := a.store.AppendEvent(tx, nil, nil, evType, map[string]any{
+		"path_id": pathID, "ratio": opp.Ratio, "qty": opp.Qty,
+		"executed": opp.Executed, "failed_leg": opp.FailedLeg,
+	}); err != nil {
+		log.Printf("[arbitrage] path %s: %s event insert failed: %v", pathID, evType, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[arbitrage] path %s: %s event commit failed: %v", pathID, evType, err)
+	}
+}
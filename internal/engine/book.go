@@ -1,8 +1,27 @@
 package engine
 
-import "sort"
+import (
+	"math/rand"
+	"time"
 
-// OrderEntry is a resting order in the book.
+	"wager-exchange/internal/model"
+)
+
+const (
+	skipListMaxLevel = 16
+	skipListP        = 0.5
+)
+
+// OrderEntry is a resting order in the book. It is a node in its Level's
+// intrusive doubly linked FIFO queue, so a specific entry can be unlinked
+// in O(1) without scanning the level's other orders.
+//
+// RemainingQty is always the true remaining quantity, hidden reserve
+// included — every non-iceberg code path (locking, DB persistence,
+// order status) keeps reading it exactly as before. DisplayQty and
+// TotalQty are additive: TotalQty > 0 marks an iceberg order, DisplayQty
+// is its currently visible slice, refreshed from the hidden remainder
+// (RemainingQty - DisplayQty) as it's consumed. See initIceberg.
 type OrderEntry struct {
 	OrderID      string
 	UserID       string
@@ -11,22 +30,97 @@ type OrderEntry struct {
 	RemainingQty int
 	LockedCents  int64
 	Seq          int64
+
+	DisplayQty int
+	TotalQty   int
+
+	displayMax int // iceberg clip size refreshes replenish up to
+	level      *Level
+	prev, next *OrderEntry
 }
 
-// Level is a price level with a FIFO queue of orders.
+// initIceberg turns a plain resting order into an iceberg: totalQty is
+// its true size (== RemainingQty at rest time) and displayQty is the
+// slice to show at a time. Call before the entry is added to the book.
+func (e *OrderEntry) initIceberg(totalQty, displayQty int) {
+	e.TotalQty = totalQty
+	e.displayMax = displayQty
+	if displayQty > totalQty {
+		displayQty = totalQty
+	}
+	e.DisplayQty = displayQty
+}
+
+// isIceberg reports whether e has a hidden reserve behind its visible slice.
+func (e *OrderEntry) isIceberg() bool { return e.TotalQty > 0 }
+
+// visibleQty is the quantity a taker can actually match against e in a
+// single pass: the full RemainingQty for a plain order, or just the
+// currently displayed slice for an iceberg.
+func (e *OrderEntry) visibleQty() int {
+	if !e.isIceberg() {
+		return e.RemainingQty
+	}
+	return e.DisplayQty
+}
+
+// Level is a price level with a FIFO queue of orders, stored as an
+// intrusive doubly linked list so removing a specific OrderEntry is O(1)
+// instead of scanning a slice.
 type Level struct {
-	Price  int
-	Orders []*OrderEntry
+	Price      int
+	head, tail *OrderEntry
+	count      int
 }
 
+// TotalQty sums the level's publicly visible quantity, used for depth
+// snapshots. An iceberg order only contributes its current DisplayQty,
+// keeping its hidden reserve out of the public book.
 func (l *Level) TotalQty() int {
 	t := 0
-	for _, o := range l.Orders {
-		t += o.RemainingQty
+	for o := l.head; o != nil; o = o.next {
+		t += o.visibleQty()
 	}
 	return t
 }
 
+// Orders returns the level's resting orders in FIFO order.
+func (l *Level) Orders() []*OrderEntry {
+	out := make([]*OrderEntry, 0, l.count)
+	for o := l.head; o != nil; o = o.next {
+		out = append(out, o)
+	}
+	return out
+}
+
+func (l *Level) pushBack(e *OrderEntry) {
+	e.level = l
+	e.prev = l.tail
+	e.next = nil
+	if l.tail != nil {
+		l.tail.next = e
+	} else {
+		l.head = e
+	}
+	l.tail = e
+	l.count++
+}
+
+func (l *Level) unlink(e *OrderEntry) {
+	if e.prev != nil {
+		e.prev.next = e.next
+	} else {
+		l.head = e.next
+	}
+	if e.next != nil {
+		e.next.prev = e.prev
+	} else {
+		l.tail = e.prev
+	}
+	e.prev, e.next, e.level = nil, nil, nil
+	l.count--
+}
+
 // Match represents a potential fill against a resting order.
 type Match struct {
 	Entry     *OrderEntry
@@ -34,56 +128,222 @@ type Match struct {
 	FillPrice int
 }
 
-// OrderBook is an in-memory limit order book for a single market.
+// skipListNode is one price level's slot in a priceSkipList. Level-0
+// forward/backward pointers form a plain doubly linked list, so ascending
+// and descending in-order traversal are both O(1) per step; forward
+// pointers at higher levels make insert/remove/find O(log n).
+type skipListNode struct {
+	level    *Level
+	forward  []*skipListNode
+	backward *skipListNode
+}
+
+// priceSkipList is an ordered map from price (ascending) to *Level,
+// supporting O(log n) insert, remove and find, plus O(1)-per-step
+// ascending (first -> forward) and descending (last -> backward)
+// traversal via the level-0 doubly linked list. This backs both sides of
+// the book: asks read it ascending (best ask = first), bids read it
+// descending (best bid = last).
+type priceSkipList struct {
+	head  *skipListNode
+	level int
+	size  int
+}
+
+func newPriceSkipList() *priceSkipList {
+	return &priceSkipList{
+		head:  &skipListNode{forward: make([]*skipListNode, skipListMaxLevel)},
+		level: 1,
+	}
+}
+
+func randomSkipListLevel() int {
+	lvl := 1
+	for lvl < skipListMaxLevel && rand.Float64() < skipListP {
+		lvl++
+	}
+	return lvl
+}
+
+// find returns the node for price, or nil if no level exists at that price.
+func (s *priceSkipList) find(price int) *skipListNode {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].level.Price < price {
+			x = x.forward[i]
+		}
+	}
+	x = x.forward[0]
+	if x != nil && x.level.Price == price {
+		return x
+	}
+	return nil
+}
+
+// insert adds a new level at price, which must not already exist.
+func (s *priceSkipList) insert(price int, lvl *Level) *skipListNode {
+	update := make([]*skipListNode, skipListMaxLevel)
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].level.Price < price {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+
+	newLevel := randomSkipListLevel()
+	if newLevel > s.level {
+		for i := s.level; i < newLevel; i++ {
+			update[i] = s.head
+		}
+		s.level = newLevel
+	}
+
+	node := &skipListNode{level: lvl, forward: make([]*skipListNode, newLevel)}
+	for i := 0; i < newLevel; i++ {
+		node.forward[i] = update[i].forward[i]
+		update[i].forward[i] = node
+	}
+	node.backward = update[0]
+	if node.forward[0] != nil {
+		node.forward[0].backward = node
+	}
+	s.size++
+	return node
+}
+
+// remove deletes the level at price, if one exists.
+func (s *priceSkipList) remove(price int) {
+	update := make([]*skipListNode, skipListMaxLevel)
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil && x.forward[i].level.Price < price {
+			x = x.forward[i]
+		}
+		update[i] = x
+	}
+	target := x.forward[0]
+	if target == nil || target.level.Price != price {
+		return
+	}
+	for i := 0; i < s.level; i++ {
+		if update[i].forward[i] == target {
+			update[i].forward[i] = target.forward[i]
+		}
+	}
+	if target.forward[0] != nil {
+		target.forward[0].backward = target.backward
+	}
+	for s.level > 1 && s.head.forward[s.level-1] == nil {
+		s.level--
+	}
+	s.size--
+}
+
+// first returns the lowest-priced node, or nil if the list is empty.
+func (s *priceSkipList) first() *skipListNode {
+	return s.head.forward[0]
+}
+
+// last returns the highest-priced node, or nil if the list is empty.
+func (s *priceSkipList) last() *skipListNode {
+	x := s.head
+	for i := s.level - 1; i >= 0; i-- {
+		for x.forward[i] != nil {
+			x = x.forward[i]
+		}
+	}
+	if x == s.head {
+		return nil
+	}
+	return x
+}
+
+// OrderBook is an in-memory limit order book for a single market. Each
+// side's price levels live in a priceSkipList for O(log n) insert/remove
+// and O(1)-per-step best-price/in-order traversal; each Level's FIFO
+// queue is an intrusive doubly linked list for O(1) removal of a
+// specific resting order.
 type OrderBook struct {
-	bids      map[int]*Level // price -> Level
-	asks      map[int]*Level
-	bidPrices []int // sorted descending
-	askPrices []int // sorted ascending
-	index     map[string]*OrderEntry
+	bids  *priceSkipList // ascending by price; best bid = bids.last()
+	asks  *priceSkipList // ascending by price; best ask = asks.first()
+	index map[string]*OrderEntry
+
+	// eventLog buffers every Add/Remove/ApplyFill since the book was
+	// created or last drained via Events, in Seq order. See
+	// persistence.go for the replay/snapshot subsystem built on it.
+	eventLog []model.EventLog
+	logSeq   int64
+
+	// pending reconciles fills/cancels that arrive before the Add for
+	// the order they target, see pending.go.
+	pending *pendingUpdateCache
 }
 
 func NewOrderBook() *OrderBook {
 	return &OrderBook{
-		bids:  make(map[int]*Level),
-		asks:  make(map[int]*Level),
-		index: make(map[string]*OrderEntry),
+		bids:    newPriceSkipList(),
+		asks:    newPriceSkipList(),
+		index:   make(map[string]*OrderEntry),
+		pending: newPendingUpdateCache(pendingUpdateCapacity, pendingUpdateTTL),
 	}
 }
 
 // ── Queries ──────────────────────────────────────────
 
 func (b *OrderBook) BestBid() *int {
-	if len(b.bidPrices) == 0 {
+	n := b.bids.last()
+	if n == nil {
 		return nil
 	}
-	p := b.bidPrices[0]
+	p := n.level.Price
 	return &p
 }
 
 func (b *OrderBook) BestAsk() *int {
-	if len(b.askPrices) == 0 {
+	n := b.asks.first()
+	if n == nil {
 		return nil
 	}
-	p := b.askPrices[0]
+	p := n.level.Price
 	return &p
 }
 
 func (b *OrderBook) Size() int { return len(b.index) }
 
+// Contains reports whether orderID is still resting on the book.
+func (b *OrderBook) Contains(orderID string) bool {
+	_, ok := b.index[orderID]
+	return ok
+}
+
+// CountOpenByUser returns how many resting orders a user currently has on
+// the book, used to enforce an instrument's max_open_orders_per_user.
+func (b *OrderBook) CountOpenByUser(userID string) int {
+	n := 0
+	for _, e := range b.index {
+		if e.UserID == userID {
+			n++
+		}
+	}
+	return n
+}
+
 type BookLevel struct {
 	Price int `json:"price"`
 	Qty   int `json:"qty"`
 }
 
 func (b *OrderBook) Snapshot(depth int) (bids, asks []BookLevel) {
-	for i := 0; i < len(b.bidPrices) && i < depth; i++ {
-		p := b.bidPrices[i]
-		bids = append(bids, BookLevel{Price: p, Qty: b.bids[p].TotalQty()})
+	n := b.bids.last()
+	for i := 0; i < depth && n != nil; i++ {
+		bids = append(bids, BookLevel{Price: n.level.Price, Qty: n.level.TotalQty()})
+		n = n.backward
 	}
-	for i := 0; i < len(b.askPrices) && i < depth; i++ {
-		p := b.askPrices[i]
-		asks = append(asks, BookLevel{Price: p, Qty: b.asks[p].TotalQty()})
+	n = b.asks.first()
+	for i := 0; i < depth && n != nil; i++ {
+		asks = append(asks, BookLevel{Price: n.level.Price, Qty: n.level.TotalQty()})
+		n = n.forward[0]
 	}
 	if bids == nil {
 		bids = []BookLevel{}
@@ -94,80 +354,214 @@ func (b *OrderBook) Snapshot(depth int) (bids, asks []BookLevel) {
 	return
 }
 
+// AllBids returns every resting buy order across all price levels, sorted
+// by price descending with FIFO order preserved within each level. Used
+// by the EPOCH matching mode's auction, which needs the full book rather
+// than just a depth-limited view.
+func (b *OrderBook) AllBids() []*OrderEntry {
+	var out []*OrderEntry
+	for n := b.bids.last(); n != nil; n = n.backward {
+		out = append(out, n.level.Orders()...)
+	}
+	return out
+}
+
+// AllAsks returns every resting sell order across all price levels,
+// sorted by price ascending with FIFO order preserved within each level.
+func (b *OrderBook) AllAsks() []*OrderEntry {
+	var out []*OrderEntry
+	for n := b.asks.first(); n != nil; n = n.forward[0] {
+		out = append(out, n.level.Orders()...)
+	}
+	return out
+}
+
 // ── Add / Remove ─────────────────────────────────────
 
+// Add rests e on the book, unless a fill or cancel for e.OrderID already
+// arrived out of order (ApplyFill/Remove called before this Add) and is
+// still within its TTL in the pending-update cache: a pending cancel
+// means e is skipped entirely rather than resurrecting a canceled order,
+// and a pending fill is applied to e.RemainingQty first (skipping
+// insertion too, if that exhausts it).
 func (b *OrderBook) Add(e *OrderEntry) {
 	if _, exists := b.index[e.OrderID]; exists {
 		return
 	}
+	if u, ok := b.pending.take(e.OrderID, time.Now()); ok {
+		switch u.kind {
+		case pendingCancel:
+			return
+		case pendingFill:
+			e.RemainingQty -= u.fillQty
+			if e.RemainingQty <= 0 {
+				return
+			}
+		}
+	}
 	b.index[e.OrderID] = e
 	if e.Side == "BUY" {
-		b.addToSide(b.bids, &b.bidPrices, e, false) // desc
+		b.addToSide(b.bids, e)
 	} else {
-		b.addToSide(b.asks, &b.askPrices, e, true) // asc
+		b.addToSide(b.asks, e)
+	}
+	b.logEvent(model.EventOrderAdd, toSnapshotEntry(e))
+}
+
+func (b *OrderBook) addToSide(sl *priceSkipList, e *OrderEntry) {
+	node := sl.find(e.PriceCents)
+	if node == nil {
+		node = sl.insert(e.PriceCents, &Level{Price: e.PriceCents})
 	}
+	node.level.pushBack(e)
 }
 
+// Remove unlinks orderID from the book. If orderID isn't resting (its
+// Add hasn't landed yet), the cancel is stashed in the pending-update
+// cache instead of silently no-oping, so the eventual Add can honor it.
 func (b *OrderBook) Remove(orderID string) *OrderEntry {
+	e := b.removeEntry(orderID)
+	if e != nil {
+		b.logEvent(model.EventOrderRemove, map[string]any{"order_id": orderID})
+		return e
+	}
+	b.pending.stashCancel(orderID, time.Now())
+	return nil
+}
+
+// removeEntry does the actual unlinking, shared by Remove and ApplyFill's
+// full-fill path. It does not log — Remove logs ORDER_REMOVE itself, and
+// ApplyFill's ORDER_FILL event already captures a fill that empties the
+// order, so Replay never needs a second event for the same mutation.
+func (b *OrderBook) removeEntry(orderID string) *OrderEntry {
 	e, ok := b.index[orderID]
 	if !ok {
 		return nil
 	}
 	delete(b.index, orderID)
-	if e.Side == "BUY" {
-		b.removeFromSide(b.bids, &b.bidPrices, e)
-	} else {
-		b.removeFromSide(b.asks, &b.askPrices, e)
+	lvl := e.level
+	lvl.unlink(e)
+	if lvl.count == 0 {
+		sl := b.asks
+		if e.Side == "BUY" {
+			sl = b.bids
+		}
+		sl.remove(lvl.Price)
 	}
 	return e
 }
 
 // ── Matching ─────────────────────────────────────────
 
+// STPMatches is the result of a self-trade-aware match walk.
+type STPMatches struct {
+	Matches       []Match
+	CancelMakerID []string // maker orders to cancel due to CANCEL_MAKER/CANCEL_BOTH
+	CancelTaker   bool     // taker hit CANCEL_TAKER/CANCEL_BOTH and must be rejected
+}
+
+// FindMatchesSTP walks the book like FindMatches but applies a self-trade
+// prevention policy whenever the resting order belongs to userID:
+//   - "" (none): behaves like the legacy excludeUserID skip
+//   - CANCEL_TAKER: stops matching and flags the taker for rejection
+//   - CANCEL_MAKER: skips the maker and queues it for cancellation
+//   - CANCEL_BOTH: queues the maker for cancellation and flags the taker
+func (b *OrderBook) FindMatchesSTP(side string, priceCents *int, maxQty int, userID string, stp string) STPMatches {
+	var res STPMatches
+	rem := maxQty
+
+	walk := func(start *skipListNode, next func(*skipListNode) *skipListNode, priceOK func(p int) bool) bool {
+		for n := start; n != nil; n = next(n) {
+			if rem <= 0 {
+				return true
+			}
+			if !priceOK(n.level.Price) {
+				return true
+			}
+			for entry := n.level.head; entry != nil; entry = entry.next {
+				if rem <= 0 {
+					return true
+				}
+				if entry.UserID == userID {
+					switch stp {
+					case "CANCEL_TAKER":
+						res.CancelTaker = true
+						return false
+					case "CANCEL_MAKER":
+						res.CancelMakerID = append(res.CancelMakerID, entry.OrderID)
+						continue
+					case "CANCEL_BOTH":
+						res.CancelMakerID = append(res.CancelMakerID, entry.OrderID)
+						res.CancelTaker = true
+						return false
+					default:
+						continue
+					}
+				}
+				fq := min(rem, entry.visibleQty())
+				res.Matches = append(res.Matches, Match{Entry: entry, FillQty: fq, FillPrice: n.level.Price})
+				rem -= fq
+			}
+		}
+		return true
+	}
+
+	if side == "BUY" {
+		walk(b.asks.first(), func(n *skipListNode) *skipListNode { return n.forward[0] },
+			func(p int) bool { return priceCents == nil || p <= *priceCents })
+	} else {
+		walk(b.bids.last(), func(n *skipListNode) *skipListNode { return n.backward },
+			func(p int) bool { return priceCents == nil || p >= *priceCents })
+	}
+
+	if res.CancelTaker {
+		res.Matches = nil
+	}
+	return res
+}
+
 // FindMatches returns potential matches without mutating the book.
 func (b *OrderBook) FindMatches(side string, priceCents *int, maxQty int, excludeUserID string) []Match {
 	var matches []Match
 	rem := maxQty
 
 	if side == "BUY" {
-		for _, askPrice := range b.askPrices {
+		for n := b.asks.first(); n != nil; n = n.forward[0] {
 			if rem <= 0 {
 				break
 			}
-			if priceCents != nil && askPrice > *priceCents {
+			if priceCents != nil && n.level.Price > *priceCents {
 				break
 			}
-			level := b.asks[askPrice]
-			for _, entry := range level.Orders {
+			for entry := n.level.head; entry != nil; entry = entry.next {
 				if rem <= 0 {
 					break
 				}
 				if entry.UserID == excludeUserID {
 					continue
 				}
-				fq := min(rem, entry.RemainingQty)
-				matches = append(matches, Match{Entry: entry, FillQty: fq, FillPrice: askPrice})
+				fq := min(rem, entry.visibleQty())
+				matches = append(matches, Match{Entry: entry, FillQty: fq, FillPrice: n.level.Price})
 				rem -= fq
 			}
 		}
 	} else {
-		for _, bidPrice := range b.bidPrices {
+		for n := b.bids.last(); n != nil; n = n.backward {
 			if rem <= 0 {
 				break
 			}
-			if priceCents != nil && bidPrice < *priceCents {
+			if priceCents != nil && n.level.Price < *priceCents {
 				break
 			}
-			level := b.bids[bidPrice]
-			for _, entry := range level.Orders {
+			for entry := n.level.head; entry != nil; entry = entry.next {
 				if rem <= 0 {
 					break
 				}
 				if entry.UserID == excludeUserID {
 					continue
 				}
-				fq := min(rem, entry.RemainingQty)
-				matches = append(matches, Match{Entry: entry, FillQty: fq, FillPrice: bidPrice})
+				fq := min(rem, entry.visibleQty())
+				matches = append(matches, Match{Entry: entry, FillQty: fq, FillPrice: n.level.Price})
 				rem -= fq
 			}
 		}
@@ -175,58 +569,36 @@ func (b *OrderBook) FindMatches(side string, priceCents *int, maxQty int, exclud
 	return matches
 }
 
-// ApplyFill reduces the remaining qty of a resting order.
-// Returns remaining qty after fill. Removes from book if fully filled.
+// ApplyFill reduces the remaining qty of a resting order. Returns
+// remaining qty after fill, removing it from the book if fully filled.
+// If orderID isn't resting yet, the fill is stashed in the
+// pending-update cache instead of silently no-oping, so the eventual Add
+// can apply it rather than resting a now-stale full quantity.
 func (b *OrderBook) ApplyFill(orderID string, fillQty int) int {
 	e := b.index[orderID]
 	if e == nil {
+		b.pending.stashFill(orderID, fillQty, time.Now())
 		return 0
 	}
 	e.RemainingQty -= fillQty
+	if e.isIceberg() {
+		e.DisplayQty -= fillQty
+	}
+	b.logEvent(model.EventOrderFill, map[string]any{"order_id": orderID, "fill_qty": fillQty})
 	if e.RemainingQty <= 0 {
-		b.Remove(orderID)
+		b.removeEntry(orderID)
 		return 0
 	}
-	return e.RemainingQty
-}
-
-// ── Internals ────────────────────────────────────────
-
-func (b *OrderBook) addToSide(m map[int]*Level, prices *[]int, e *OrderEntry, asc bool) {
-	level, ok := m[e.PriceCents]
-	if !ok {
-		level = &Level{Price: e.PriceCents}
-		m[e.PriceCents] = level
-		*prices = append(*prices, e.PriceCents)
-		if asc {
-			sort.Ints(*prices)
-		} else {
-			sort.Sort(sort.Reverse(sort.IntSlice(*prices)))
-		}
-	}
-	level.Orders = append(level.Orders, e)
-}
-
-func (b *OrderBook) removeFromSide(m map[int]*Level, prices *[]int, e *OrderEntry) {
-	level, ok := m[e.PriceCents]
-	if !ok {
-		return
-	}
-	for i, o := range level.Orders {
-		if o.OrderID == e.OrderID {
-			level.Orders = append(level.Orders[:i], level.Orders[i+1:]...)
-			break
-		}
-	}
-	if len(level.Orders) == 0 {
-		delete(m, e.PriceCents)
-		for i, p := range *prices {
-			if p == e.PriceCents {
-				*prices = append((*prices)[:i], (*prices)[i+1:]...)
-				break
-			}
-		}
+	if e.isIceberg() && e.DisplayQty <= 0 {
+		// Visible slice exhausted but hidden reserve remains: refresh it
+		// and re-queue at the back of this price level's FIFO, preserving
+		// price priority but losing time priority for the refreshed slice.
+		e.DisplayQty = min(e.displayMax, e.RemainingQty)
+		lvl := e.level
+		lvl.unlink(e)
+		lvl.pushBack(e)
 	}
+	return e.RemainingQty
 }
 
 func min(a, b int) int {
@@ -235,3 +607,9 @@ func min(a, b int) int {
 	}
 	return b
 }
+
+func (b *OrderBook) logEvent(evType string, payload any) {
+	b.logSeq++
+	seq := b.logSeq
+	b.eventLog = append(b.eventLog, model.EventLog{Seq: &seq, Type: evType, PayloadJSON: payload})
+}
@@ -1,6 +1,9 @@
 package engine
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 func TestAddAndBestBidAsk(t *testing.T) {
 	b := NewOrderBook()
@@ -218,6 +221,39 @@ func TestFindMatchesSellSide(t *testing.T) {
 	}
 }
 
+func TestFindMatchesSTPCancelTaker(t *testing.T) {
+	b := NewOrderBook()
+	b.Add(&OrderEntry{OrderID: "a1", UserID: "u1", Side: "SELL", PriceCents: 50, RemainingQty: 5, Seq: 1})
+	b.Add(&OrderEntry{OrderID: "a2", UserID: "u2", Side: "SELL", PriceCents: 51, RemainingQty: 5, Seq: 2})
+
+	price := 99
+	res := b.FindMatchesSTP("BUY", &price, 10, "u1", "CANCEL_TAKER")
+	if !res.CancelTaker {
+		t.Fatal("expected CancelTaker=true")
+	}
+	if len(res.Matches) != 0 {
+		t.Fatalf("expected no matches when taker is canceled, got %d", len(res.Matches))
+	}
+}
+
+func TestFindMatchesSTPCancelMaker(t *testing.T) {
+	b := NewOrderBook()
+	b.Add(&OrderEntry{OrderID: "a1", UserID: "u1", Side: "SELL", PriceCents: 50, RemainingQty: 5, Seq: 1})
+	b.Add(&OrderEntry{OrderID: "a2", UserID: "u2", Side: "SELL", PriceCents: 51, RemainingQty: 5, Seq: 2})
+
+	price := 99
+	res := b.FindMatchesSTP("BUY", &price, 10, "u1", "CANCEL_MAKER")
+	if res.CancelTaker {
+		t.Fatal("expected CancelTaker=false")
+	}
+	if len(res.CancelMakerID) != 1 || res.CancelMakerID[0] != "a1" {
+		t.Fatalf("expected a1 flagged for cancellation, got %v", res.CancelMakerID)
+	}
+	if len(res.Matches) != 1 || res.Matches[0].Entry.OrderID != "a2" {
+		t.Fatalf("expected match against a2 only, got %v", res.Matches)
+	}
+}
+
 func TestCalcLock(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -269,3 +305,57 @@ func calcLock(side model_OrderSide, otype model_OrderType, priceCents *int, qty
 }
 
 func intPtr(v int) *int { return &v }
+
+// Markets here only ever quote prices in 1-99c, so "10k+ price levels"
+// means 10k+ resting orders stacked across that same 99-level range
+// rather than 10k+ distinct prices. These benchmarks stress that shape:
+// a deep book with many orders per level, exercising the skip list's
+// level lookup and the intrusive FIFO queue's O(1) removal.
+
+func seedDeepBook(n int) *OrderBook {
+	b := NewOrderBook()
+	for i := 0; i < n; i++ {
+		side := "BUY"
+		price := 1 + i%50
+		if i%2 == 1 {
+			side = "SELL"
+			price = 50 + i%50
+		}
+		b.Add(&OrderEntry{
+			OrderID:      fmt.Sprintf("seed-%d", i),
+			UserID:       "seed",
+			Side:         side,
+			PriceCents:   price,
+			RemainingQty: 1,
+			Seq:          int64(i),
+		})
+	}
+	return b
+}
+
+func BenchmarkOrderBookAddRemove(b *testing.B) {
+	book := seedDeepBook(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id := fmt.Sprintf("bench-%d", i)
+		book.Add(&OrderEntry{OrderID: id, UserID: "bench", Side: "BUY", PriceCents: 1 + i%50, RemainingQty: 1, Seq: int64(i)})
+		book.Remove(id)
+	}
+}
+
+func BenchmarkOrderBookFindMatches(b *testing.B) {
+	book := seedDeepBook(10000)
+	price := 99
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		book.FindMatches("BUY", &price, 5, "nomatch")
+	}
+}
+
+func BenchmarkOrderBookSnapshot(b *testing.B) {
+	book := seedDeepBook(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		book.Snapshot(10)
+	}
+}
@@ -2,13 +2,21 @@ package engine
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
-	"wager-exchange/internal/db"
 	"wager-exchange/internal/model"
+	"wager-exchange/internal/store"
 )
 
 // PublishFunc broadcasts a WS message for a market.
@@ -19,18 +27,154 @@ type PublishFunc func(marketID, msgType string, data any)
 type Manager struct {
 	engines map[string]*MarketEngine
 	mu      sync.RWMutex
-	store   *db.Store
+	store   store.Store
 	publish PublishFunc
 	feeBps  int
+
+	hedgeGroups   map[string]*HedgeGroup   // groupID -> group
+	hedgeByMarket map[string][]*HedgeGroup // marketID -> groups it belongs to
+
+	groupedOrders map[string][]*GroupedOrder // groupID -> still-tracked legs
+	legsByOrderID map[string]*GroupedOrder   // orderID -> its leg, for fill lookups
 }
 
-func NewManager(store *db.Store, pub PublishFunc, feeBps int) *Manager {
+func NewManager(store store.Store, pub PublishFunc, feeBps int) *Manager {
 	return &Manager{
-		engines: make(map[string]*MarketEngine),
-		store:   store,
-		publish: pub,
-		feeBps:  feeBps,
+		engines:       make(map[string]*MarketEngine),
+		store:         store,
+		publish:       pub,
+		feeBps:        feeBps,
+		hedgeGroups:   make(map[string]*HedgeGroup),
+		hedgeByMarket: make(map[string][]*HedgeGroup),
+		groupedOrders: make(map[string][]*GroupedOrder),
+		legsByOrderID: make(map[string]*GroupedOrder),
+	}
+}
+
+// HedgeKind identifies how the markets in a HedgeGroup relate to each
+// other for the purpose of offsetting collateral and cascading resolution.
+// Aliased to model.HedgeKind so model.CalcLockWithHedge can apply
+// kind-specific netting without engine importing a cycle back into model.
+type HedgeKind = model.HedgeKind
+
+const (
+	// HedgeMutuallyExclusive groups markets where exactly one member
+	// resolves YES, e.g. an N-way "who wins" market set. Resolving any
+	// member YES auto-resolves the rest NO.
+	HedgeMutuallyExclusive = model.HedgeMutuallyExclusive
+	// HedgeInverse groups a pair of markets whose YES outcomes are
+	// logical opposites. Resolving one auto-resolves the other to the
+	// opposite outcome.
+	HedgeInverse = model.HedgeInverse
+)
+
+// HedgeGroup is a set of markets whose outcomes are logically linked, so a
+// user's position in one offsets the collateral an order in another
+// requires, and resolving one cascades to the rest.
+type HedgeGroup struct {
+	ID        string
+	MarketIDs []string
+	Kind      HedgeKind
+}
+
+// RegisterHedgeGroup links marketIDs so that, from then on, PlaceOrder on
+// any member market discounts required collateral for the user's
+// positions in the others (see model.CalcLockWithHedge), and resolving
+// any member cascades resolution to the rest per kind.
+func (m *Manager) RegisterHedgeGroup(groupID string, marketIDs []string, kind HedgeKind) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	g := &HedgeGroup{ID: groupID, MarketIDs: marketIDs, Kind: kind}
+	m.hedgeGroups[groupID] = g
+	for _, mid := range marketIDs {
+		m.hedgeByMarket[mid] = append(m.hedgeByMarket[mid], g)
+	}
+}
+
+// hedgeSiblings returns every other market hedged against marketID across
+// all groups it belongs to, used to discount collateral for the user's
+// correlated positions.
+func (m *Manager) hedgeSiblings(marketID string) []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var out []string
+	for _, g := range m.hedgeByMarket[marketID] {
+		for _, mid := range g.MarketIDs {
+			if mid != marketID {
+				out = append(out, mid)
+			}
+		}
+	}
+	return out
+}
+
+// hedgeKind returns the HedgeKind of the first hedge group marketID
+// belongs to. A market only ever belongs to one group in practice (an
+// N-way MUTUALLY_EXCLUSIVE set or a 2-member INVERSE pair), so "first" is
+// unambiguous for every group this repo creates via RegisterHedgeGroup.
+func (m *Manager) hedgeKind(marketID string) HedgeKind {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if groups := m.hedgeByMarket[marketID]; len(groups) > 0 {
+		return groups[0].Kind
+	}
+	return HedgeMutuallyExclusive
+}
+
+// autoResolveSiblings cascades marketID's resolution to the other members
+// of its hedge groups, settling every sibling within tx — the same
+// transaction the triggering market's own resolution is committed in —
+// instead of each sibling resolving independently after the fact. A
+// MUTUALLY_EXCLUSIVE sibling resolves NO (at most one member can be YES);
+// an INVERSE sibling resolves to the opposite outcome. Already-resolved
+// siblings are skipped.
+//
+// Each sibling's settlement still runs on that sibling's own engine
+// goroutine (resolveInTxCmd, dispatched over its cmdCh) so a market's
+// state is never mutated from any goroutine but its own; what's shared is
+// only the store.Tx. If any sibling fails, the error propagates back to
+// resolveMarket, which rolls back the whole tx — so a hedge group commits
+// fully or not at all, instead of the previous behavior where a failed
+// sibling was merely logged and left stuck unresolved.
+func (m *Manager) autoResolveSiblings(tx store.Tx, marketID, resolvesTo, adminID string) error {
+	ctx := context.Background()
+	m.mu.RLock()
+	groups := m.hedgeByMarket[marketID]
+	m.mu.RUnlock()
+
+	for _, g := range groups {
+		for _, sibID := range g.MarketIDs {
+			if sibID == marketID {
+				continue
+			}
+			sibResolvesTo := "NO"
+			if g.Kind == HedgeInverse {
+				if resolvesTo == "NO" {
+					sibResolvesTo = "YES"
+				}
+			}
+			mkt, err := m.store.GetMarket(ctx, sibID)
+			if err != nil {
+				return fmt.Errorf("hedge group %s: load sibling %s: %w", g.ID, sibID, err)
+			}
+			if mkt == nil || mkt.Status == model.MarketResolved {
+				continue
+			}
+			eng := m.GetEngine(sibID)
+			if eng == nil {
+				return fmt.Errorf("hedge group %s: sibling %s has no running engine", g.ID, sibID)
+			}
+			ch := make(chan resolveInTxResult, 1)
+			eng.cmdCh <- resolveInTxCmd{tx: tx, resolvesTo: sibResolvesTo, adminID: adminID, ch: ch}
+			res := <-ch
+			if res.err != nil {
+				return fmt.Errorf("hedge group %s: resolve sibling %s: %w", g.ID, sibID, res.err)
+			}
+			log.Printf("[engine] hedge group %s: auto-resolved sibling %s to %s within triggering market's tx: %d positions, %d payout",
+				g.ID, sibID, sibResolvesTo, res.settled, res.payout)
+		}
 	}
+	return nil
 }
 
 func (m *Manager) Boot(ctx context.Context) error {
@@ -53,7 +197,7 @@ func (m *Manager) StartEngine(ctx context.Context, marketID string) error {
 	if _, ok := m.engines[marketID]; ok {
 		return nil
 	}
-	eng, err := newMarketEngine(ctx, marketID, m.store, m.publish, m.feeBps)
+	eng, err := newMarketEngine(ctx, marketID, m.store, m.publish, m.feeBps, m.hedgeSiblings, m.hedgeKind, m.autoResolveSiblings, m.onMakerFill)
 	if err != nil {
 		return err
 	}
@@ -77,55 +221,439 @@ func (m *Manager) GetBook(marketID string) (bids, asks []BookLevel) {
 	return eng.book.Snapshot(20)
 }
 
+// GetCurrentKline returns the in-progress bar for a market/interval, used
+// to merge live state into the REST klines response.
+func (m *Manager) GetCurrentKline(marketID, interval string) (model.Kline, bool) {
+	eng := m.GetEngine(marketID)
+	if eng == nil {
+		return model.Kline{}, false
+	}
+	return eng.CurrentKline(interval)
+}
+
+// UpdateInstrument pushes new instrument metadata to a market's engine so
+// order placement enforces it immediately.
+func (m *Manager) UpdateInstrument(marketID string, instrument model.Instrument, adminID string) error {
+	eng := m.GetEngine(marketID)
+	if eng == nil {
+		return fmt.Errorf("engine not running for this market")
+	}
+	return eng.UpdateInstrument(instrument, adminID)
+}
+
+// PlaceOrdersBatch places several orders from one user in a market within a
+// single engine tick and DB transaction, e.g. a market maker laddering a book.
+func (m *Manager) PlaceOrdersBatch(marketID, userID string, req model.BatchPlaceOrderReq) (model.BatchPlaceOrderResult, error) {
+	eng := m.GetEngine(marketID)
+	if eng == nil {
+		return model.BatchPlaceOrderResult{}, fmt.Errorf("engine not running for this market")
+	}
+	return eng.PlaceOrders(userID, req.Orders, req.GroupID, req.AllOrNone, req.CancelOnPartial), nil
+}
+
+// SuspendMarket blocks new order placement and cancellation on a market,
+// either immediately or on the schedule given by suspendAt.
+func (m *Manager) SuspendMarket(ctx context.Context, marketID string, purge bool, suspendAt *time.Time) error {
+	eng := m.GetEngine(marketID)
+	if eng == nil {
+		return fmt.Errorf("engine not running for this market")
+	}
+	return eng.Suspend(purge, suspendAt)
+}
+
+// ResumeMarket re-enables order placement and cancellation on a
+// previously suspended market.
+func (m *Manager) ResumeMarket(ctx context.Context, marketID string) error {
+	eng := m.GetEngine(marketID)
+	if eng == nil {
+		return fmt.Errorf("engine not running for this market")
+	}
+	return eng.Resume()
+}
+
+// PlaceOrderWithRetry places an order, retrying with exponential backoff
+// when the engine rejects it for a reason listed in policy.RetryableReasons
+// (transient DB contention, not a validation failure). req.ClientOrderID
+// must be set: it's what makes a retried attempt idempotent, since the
+// engine recognizes the same key on a later attempt and replays the first
+// attempt's outcome instead of placing a second order.
+func (m *Manager) PlaceOrderWithRetry(ctx context.Context, marketID, userID string, req model.PlaceOrderReq, policy model.RetryPolicy) (model.PlaceOrderResult, error) {
+	eng := m.GetEngine(marketID)
+	if eng == nil {
+		return model.PlaceOrderResult{}, fmt.Errorf("engine not running for this market")
+	}
+
+	backoff := policy.InitialBackoff
+	var result model.PlaceOrderResult
+	for attempt := 1; attempt <= policy.MaxAttempts; attempt++ {
+		result = eng.PlaceOrder(userID, req)
+		if result.Status != model.StatusRejected || !isRetryableReason(result.Reason, policy.RetryableReasons) {
+			return result, nil
+		}
+		if attempt == policy.MaxAttempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return result, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+		if backoff > policy.MaxBackoff {
+			backoff = policy.MaxBackoff
+		}
+	}
+	return result, nil
+}
+
+// isRetryableReason reports whether a REJECTED result's reason matches one
+// of the caller's retryable prefixes (e.g. "commit failed: ..." matches
+// "commit failed").
+func isRetryableReason(reason string, retryable []string) bool {
+	for _, r := range retryable {
+		if strings.HasPrefix(reason, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// BatchPlaceOrdersWithRetry places each of reqs independently via
+// PlaceOrderWithRetry, so a transient failure retrying one order never
+// blocks or rolls back the others — unlike PlaceOrdersBatch, which commits
+// an entire ladder in one engine tick/transaction. Each result lands at
+// its request's own index, so callers get (order, error) pairs in input
+// order the same way a single PlaceOrderWithRetry call does per-order.
+func (m *Manager) BatchPlaceOrdersWithRetry(ctx context.Context, marketID, userID string, reqs []model.PlaceOrderReq, policy model.RetryPolicy) ([]model.PlaceOrderResult, error) {
+	if m.GetEngine(marketID) == nil {
+		return nil, fmt.Errorf("engine not running for this market")
+	}
+	results := make([]model.PlaceOrderResult, len(reqs))
+	for i, req := range reqs {
+		result, err := m.PlaceOrderWithRetry(ctx, marketID, userID, req, policy)
+		if err != nil {
+			return results, err
+		}
+		results[i] = result
+	}
+	return results, nil
+}
+
+// GroupedOrder is one still-resting leg of a MultiTrade, tracked so
+// CancelGroup can unwind it and a fill can trigger its counter-trade.
+type GroupedOrder struct {
+	GroupID           string
+	MarketID          string
+	OrderID           string
+	UserID            string
+	CounterSide       model.OrderSide
+	CounterPriceCents *int
+	CounterQty        int
+	CounterPosted     bool
+}
+
+// PlaceMultiTrade places every leg of req across its markets under one
+// GroupID, so strategies that need legs to live or die together (market
+// making, arbitrage) have it as a primitive. If any leg is rejected, every
+// leg already placed is canceled and the group is not tracked.
+func (m *Manager) PlaceMultiTrade(userID string, req model.MultiTradeReq) (model.MultiTradeResult, error) {
+	groupID := req.GroupID
+	if groupID == "" {
+		groupID = uuid.New().String()
+	}
+
+	results := make([]model.PlaceOrderResult, len(req.Legs))
+	var placed []*GroupedOrder
+
+	for i, leg := range req.Legs {
+		eng := m.GetEngine(leg.MarketID)
+		if eng == nil {
+			results[i] = model.PlaceOrderResult{Status: model.StatusRejected, Reason: "engine not running for this market"}
+			m.cancelGroupedLegs(placed)
+			return model.MultiTradeResult{GroupID: groupID, Results: results}, nil
+		}
+
+		result := eng.PlaceOrder(userID, model.PlaceOrderReq{
+			Side: leg.Side, Type: model.TypeLimit, PriceCents: leg.PriceCents, Qty: leg.Qty,
+		})
+		results[i] = result
+		if result.Status == model.StatusRejected {
+			m.cancelGroupedLegs(placed)
+			return model.MultiTradeResult{GroupID: groupID, Results: results}, nil
+		}
+
+		placed = append(placed, &GroupedOrder{
+			GroupID: groupID, MarketID: leg.MarketID, OrderID: result.OrderID, UserID: userID,
+			CounterSide: oppositeSide(leg.Side), CounterPriceCents: leg.CounterRateCents, CounterQty: leg.Qty,
+		})
+	}
+
+	m.mu.Lock()
+	m.groupedOrders[groupID] = placed
+	for _, g := range placed {
+		m.legsByOrderID[g.OrderID] = g
+	}
+	m.mu.Unlock()
+
+	return model.MultiTradeResult{GroupID: groupID, Results: results}, nil
+}
+
+// CancelGroup cancels every still-resting leg of a MultiTrade group. The
+// legs are canceled one at a time, each in its own transaction, so the
+// group as a whole is not canceled atomically: a leg that fails to cancel
+// neither stops nor undoes the others, and the first such error is
+// returned. Each leg is canceled through its market's own CancelOrder, which
+// releases the wallet lock and removes it from OrderBook consistently —
+// reaching into OrderBook.Remove directly would skip the lock release and
+// leave the leg's collateral stranded.
+func (m *Manager) CancelGroup(groupID string) error {
+	m.mu.Lock()
+	legs := m.groupedOrders[groupID]
+	delete(m.groupedOrders, groupID)
+	for _, g := range legs {
+		delete(m.legsByOrderID, g.OrderID)
+	}
+	m.mu.Unlock()
+
+	return m.cancelGroupedLegs(legs)
+}
+
+func (m *Manager) cancelGroupedLegs(legs []*GroupedOrder) error {
+	var firstErr error
+	for _, g := range legs {
+		eng := m.GetEngine(g.MarketID)
+		if eng == nil {
+			continue
+		}
+		if err := eng.CancelOrder(g.OrderID, g.UserID); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// onMakerFill checks whether a filled resting order is a MultiTrade leg
+// with a pending counter-trade, and if the leg is now fully filled, posts
+// the counter leg. Runs via time.AfterFunc rather than inline so it can
+// safely call PlaceOrder again, including on the market that just called
+// it — that engine's goroutine is still finishing the command that
+// produced this fill and can't process another until it returns.
+func (m *Manager) onMakerFill(orderID string, fullyFilled bool) {
+	if !fullyFilled {
+		return
+	}
+	m.mu.Lock()
+	g := m.legsByOrderID[orderID]
+	if g == nil || g.CounterPosted || g.CounterPriceCents == nil {
+		m.mu.Unlock()
+		return
+	}
+	g.CounterPosted = true
+	m.mu.Unlock()
+
+	time.AfterFunc(0, func() {
+		eng := m.GetEngine(g.MarketID)
+		if eng == nil {
+			return
+		}
+		eng.PlaceOrder(g.UserID, model.PlaceOrderReq{
+			Side: g.CounterSide, Type: model.TypeLimit, PriceCents: g.CounterPriceCents, Qty: g.CounterQty,
+		})
+	})
+}
+
 // ── MarketEngine ─────────────────────────────────────
 
 type MarketEngine struct {
-	marketID string
-	book     *OrderBook
-	seq      int64
-	cmdCh    chan command
-	store    *db.Store
-	publish  PublishFunc
-	feeBps   int
+	marketID       string
+	book           *OrderBook
+	seq            int64
+	cmdCh          chan command
+	store          store.Store
+	publish        PublishFunc
+	feeBps         int
+	klines         map[string]*model.Kline // interval -> in-progress bar
+	instrument     model.Instrument
+	lastTradeCents *int
+
+	// Epoch batch-auction state, unused when matchingMode is CONTINUOUS.
+	matchingMode    model.MatchingMode
+	epochDurationMs int
+	epochID         string
+	epochSeed       int64
+	epochStartAt    time.Time
+	epochEndAt      time.Time
+	epochCutoffAt   time.Time
+
+	// Suspension state. suspendGen is bumped every time suspension state
+	// changes (immediate suspend, resume, or a new schedule), so a
+	// suspendTickCmd from a stale AfterFunc can recognize it's been
+	// superseded and no-op instead of re-suspending a resumed market.
+	suspended  bool
+	suspendGen int64
+
+	// tradesSinceSnapshot counts fills since the last market_snapshots
+	// write, so saveSnapshot also fires after snapshotEveryTrades even if
+	// the next scheduleSnapshotTimer tick is still a while off.
+	tradesSinceSnapshot int
+
+	// hedgeSiblings returns the other markets hedged against this one, so
+	// processOrder can discount collateral for the user's positions in
+	// them. Nil when the market belongs to no HedgeGroup.
+	hedgeSiblings func(marketID string) []string
+	// hedgeKind returns the HedgeKind of marketID's hedge group, so
+	// CalcLockWithHedge can apply kind-specific netting. Nil when the
+	// market belongs to no HedgeGroup.
+	hedgeKind func(marketID string) HedgeKind
+	// resolveSiblingsInTx cascades this market's resolution to its hedge
+	// group siblings (MUTUALLY_EXCLUSIVE -> NO, INVERSE -> opposite)
+	// within tx, so the whole group commits or rolls back atomically. See
+	// Manager.autoResolveSiblings.
+	resolveSiblingsInTx func(tx store.Tx, marketID, resolvesTo, adminID string) error
+
+	// onMakerFill notifies the Manager whenever a resting order fills
+	// (fully or partially), so a MultiTrade leg with a pending
+	// counter-trade can be posted once it's fullyFilled.
+	onMakerFill func(orderID string, fullyFilled bool)
 }
 
-func newMarketEngine(ctx context.Context, marketID string, store *db.Store, pub PublishFunc, feeBps int) (*MarketEngine, error) {
+// epochCancelCutoff is how long before an epoch ends cancels stop being
+// accepted, so no participant can react to late information the auction
+// itself hasn't priced in yet.
+const epochCancelCutoff = 500 * time.Millisecond
+
+func newMarketEngine(ctx context.Context, marketID string, store store.Store, pub PublishFunc, feeBps int, hedgeSiblings func(string) []string, hedgeKind func(string) HedgeKind, resolveSiblingsInTx func(store.Tx, string, string, string) error, onMakerFill func(string, bool)) (*MarketEngine, error) {
 	book := NewOrderBook()
-	// Load open orders
-	orders, err := store.GetOpenOrders(ctx, marketID)
+	// Restore from the latest market_snapshots row, if one exists, instead
+	// of reconstructing the book from scratch: LoadSnapshot seeds it in one
+	// unmarshal, and only orders/cancels/fills with seq greater than the
+	// snapshot's need to be reconciled against it below. With no snapshot
+	// yet (e.g. a market's first boot), fall back to the full open-order
+	// load a reconciliation pass would otherwise replace.
+	snap, err := store.LatestSnapshot(ctx, marketID)
 	if err != nil {
 		return nil, err
 	}
-	for i := range orders {
-		o := &orders[i]
-		if o.PriceCents == nil {
-			continue
+	var sinceSeq int64
+	var openCount int
+	if snap != nil {
+		if err := book.LoadSnapshot(snap.BookJSON); err != nil {
+			return nil, fmt.Errorf("market %s: load snapshot: %w", marketID, err)
 		}
-		book.Add(&OrderEntry{
-			OrderID:      o.ID,
-			UserID:       o.UserID,
-			Side:         string(o.Side),
-			PriceCents:   *o.PriceCents,
-			RemainingQty: o.RemainingQty,
-			LockedCents:  o.LockedCents,
-			Seq:          o.Seq,
-		})
+		sinceSeq = snap.Seq
+		delta, err := store.GetOrdersSince(ctx, marketID, sinceSeq)
+		if err != nil {
+			return nil, err
+		}
+		for i := range delta {
+			o := &delta[i]
+			switch o.Status {
+			case model.StatusOpen, model.StatusPartial:
+				if o.PriceCents == nil || book.Contains(o.ID) {
+					continue
+				}
+				book.Add(&OrderEntry{
+					OrderID:      o.ID,
+					UserID:       o.UserID,
+					Side:         string(o.Side),
+					PriceCents:   *o.PriceCents,
+					RemainingQty: o.RemainingQty,
+					LockedCents:  o.LockedCents,
+					Seq:          o.Seq,
+				})
+			default:
+				// Filled/canceled/expired/rejected since the snapshot was
+				// taken: if it was resting in the restored snapshot, it no
+				// longer belongs in the live book.
+				book.Remove(o.ID)
+			}
+		}
+		openCount = book.Size()
+	} else {
+		orders, err := store.GetOpenOrders(ctx, marketID)
+		if err != nil {
+			return nil, err
+		}
+		for i := range orders {
+			o := &orders[i]
+			if o.PriceCents == nil {
+				continue
+			}
+			book.Add(&OrderEntry{
+				OrderID:      o.ID,
+				UserID:       o.UserID,
+				Side:         string(o.Side),
+				PriceCents:   *o.PriceCents,
+				RemainingQty: o.RemainingQty,
+				LockedCents:  o.LockedCents,
+				Seq:          o.Seq,
+			})
+		}
+		openCount = len(orders)
+	}
+	// Load max seq, scoped to the delta since the latest snapshot (if any)
+	// rather than scanning the market's full order/trade/event history.
+	var seq int64
+	if sinceSeq > 0 {
+		seq, err = store.MaxSeqSince(ctx, marketID, sinceSeq)
+	} else {
+		seq, err = store.MaxSeq(ctx, marketID)
 	}
-	// Load max seq
-	seq, err := store.MaxSeq(ctx, marketID)
 	if err != nil {
 		return nil, err
 	}
-	log.Printf("[engine] market %s: loaded %d orders, seq=%d", marketID, len(orders), seq)
-	return &MarketEngine{
-		marketID: marketID,
-		book:     book,
-		seq:      seq,
-		cmdCh:    make(chan command, 64),
-		store:    store,
-		publish:  pub,
-		feeBps:   feeBps,
-	}, nil
+	instrument := model.DefaultInstrument()
+	matchingMode := model.ModeContinuous
+	epochDurationMs := 0
+	suspended := false
+	var pendingSuspendAt *time.Time
+	pendingPurge := false
+	if mkt, err := store.GetMarket(ctx, marketID); err != nil {
+		return nil, err
+	} else if mkt != nil {
+		instrument = mkt.Instrument
+		if mkt.MatchingMode != "" {
+			matchingMode = mkt.MatchingMode
+		}
+		epochDurationMs = mkt.EpochDurationMs
+		suspended = mkt.Status == model.MarketSuspended
+		pendingSuspendAt = mkt.SuspendAt
+		pendingPurge = mkt.SuspendPurge
+	}
+	log.Printf("[engine] market %s: loaded %d orders, seq=%d", marketID, openCount, seq)
+	eng := &MarketEngine{
+		marketID:            marketID,
+		book:                book,
+		seq:                 seq,
+		cmdCh:               make(chan command, 64),
+		store:               store,
+		publish:             pub,
+		feeBps:              feeBps,
+		klines:              make(map[string]*model.Kline),
+		instrument:          instrument,
+		matchingMode:        matchingMode,
+		epochDurationMs:     epochDurationMs,
+		suspended:           suspended,
+		hedgeSiblings:       hedgeSiblings,
+		hedgeKind:           hedgeKind,
+		resolveSiblingsInTx: resolveSiblingsInTx,
+		onMakerFill:         onMakerFill,
+	}
+	if err := eng.seedKlines(ctx); err != nil {
+		log.Printf("[engine] market %s: kline seed failed: %v", marketID, err)
+	}
+	if eng.matchingMode == model.ModeEpoch {
+		eng.startEpoch()
+	}
+	if pendingSuspendAt != nil {
+		if pendingSuspendAt.After(time.Now()) {
+			eng.scheduleSuspensionTimer(pendingPurge, *pendingSuspendAt)
+		} else if err := eng.applySuspension(pendingPurge); err != nil {
+			log.Printf("[engine] market %s: failed to apply overdue scheduled suspension: %v", marketID, err)
+		}
+	}
+	eng.scheduleSnapshotTimer()
+	return eng, nil
 }
 
 func (e *MarketEngine) run(ctx context.Context) {
@@ -160,15 +688,122 @@ type cancelCmd struct {
 	ch      chan<- error
 }
 
+// expireCmd is self-submitted by a GTT timer when an order's
+// cancel_after_seconds has elapsed.
+type expireCmd struct {
+	orderID string
+}
+
 type resolveCmd struct {
 	resolvesTo string
 	adminID    string
 	ch         chan<- error
 }
 
+// resolveInTxCmd settles this market using a store.Tx begun (and eventually
+// committed or rolled back) by another engine's resolveMarket, so an
+// entire hedge group resolves as one atomic transaction. See
+// Manager.autoResolveSiblings.
+type resolveInTxCmd struct {
+	tx         store.Tx
+	resolvesTo string
+	adminID    string
+	ch         chan<- resolveInTxResult
+}
+
+type resolveInTxResult struct {
+	payout  int64
+	settled int
+	err     error
+}
+
+type updateInstrumentCmd struct {
+	instrument model.Instrument
+	adminID    string
+	ch         chan<- error
+}
+
+// batchPlaceCmd places several orders from one user within a single engine
+// tick, see (*MarketEngine).processBatch.
+type batchPlaceCmd struct {
+	reqs            []model.PlaceOrderReq
+	userID          string
+	groupID         string
+	allOrNone       bool
+	cancelOnPartial bool
+	ch              chan<- model.BatchPlaceOrderResult
+}
+
+// epochTickCmd is self-submitted by an epoch timer when its duration has
+// elapsed, the same way expireCmd is self-submitted for GTT orders.
+type epochTickCmd struct {
+	epochID string
+}
+
+// suspendCmd suspends a market, either immediately (suspendAt nil) or on
+// a schedule. See (*MarketEngine).suspendMarket.
+type suspendCmd struct {
+	purge     bool
+	suspendAt *time.Time
+	ch        chan<- error
+}
+
+// resumeCmd re-enables order placement and cancellation for a suspended
+// market.
+type resumeCmd struct {
+	ch chan<- error
+}
+
+// suspendTickCmd is self-submitted by a scheduled suspension's timer once
+// suspendAt arrives, the same way epochTickCmd is self-submitted for epoch
+// auctions. gen guards against firing after the market was already
+// resumed or rescheduled.
+type suspendTickCmd struct {
+	gen   int64
+	purge bool
+}
+
+// snapshotTickCmd is self-submitted every snapshotInterval to write a
+// market_snapshots row, the same way epochTickCmd self-submits for epoch
+// auctions. It reschedules itself after running, for as long as the
+// engine lives.
+type snapshotTickCmd struct{}
+
 func (c placeCmd) exec(e *MarketEngine)   { c.ch <- e.processOrder(c.userID, c.req) }
 func (c cancelCmd) exec(e *MarketEngine)  { c.ch <- e.cancelOrder(c.orderID, c.userID) }
 func (c resolveCmd) exec(e *MarketEngine) { c.ch <- e.resolveMarket(c.resolvesTo, c.adminID) }
+func (c resolveInTxCmd) exec(e *MarketEngine) {
+	payout, settled, err := e.resolveMarketInTx(c.tx, c.resolvesTo, c.adminID)
+	c.ch <- resolveInTxResult{payout: payout, settled: settled, err: err}
+}
+func (c expireCmd) exec(e *MarketEngine) { e.expireOrder(c.orderID) }
+func (c updateInstrumentCmd) exec(e *MarketEngine) {
+	c.ch <- e.updateInstrument(c.instrument, c.adminID)
+}
+func (c batchPlaceCmd) exec(e *MarketEngine) {
+	c.ch <- e.processBatch(c.userID, c.reqs, c.groupID, c.allOrNone, c.cancelOnPartial)
+}
+func (c epochTickCmd) exec(e *MarketEngine) {
+	if c.epochID != e.epochID {
+		return // stale timer from an epoch this engine already moved past
+	}
+	e.runEpochAuction()
+	e.startEpoch()
+}
+func (c suspendCmd) exec(e *MarketEngine) { c.ch <- e.suspendMarket(c.purge, c.suspendAt) }
+func (c resumeCmd) exec(e *MarketEngine)  { c.ch <- e.resumeMarket() }
+func (c suspendTickCmd) exec(e *MarketEngine) {
+	if c.gen != e.suspendGen {
+		return // market was resumed or rescheduled before this fired
+	}
+	if err := e.applySuspension(c.purge); err != nil {
+		log.Printf("[engine] market %s: scheduled suspension failed: %v", e.marketID, err)
+	}
+}
+func (c snapshotTickCmd) exec(e *MarketEngine) {
+	e.saveSnapshot()
+	e.scheduleSnapshotTimer()
+}
 
 // PlaceOrder sends a place-order command to the market goroutine and waits.
 func (e *MarketEngine) PlaceOrder(userID string, req model.PlaceOrderReq) model.PlaceOrderResult {
@@ -177,6 +812,13 @@ func (e *MarketEngine) PlaceOrder(userID string, req model.PlaceOrderReq) model.
 	return <-ch
 }
 
+// PlaceOrders sends a batch-place command to the market goroutine and waits.
+func (e *MarketEngine) PlaceOrders(userID string, reqs []model.PlaceOrderReq, groupID string, allOrNone, cancelOnPartial bool) model.BatchPlaceOrderResult {
+	ch := make(chan model.BatchPlaceOrderResult, 1)
+	e.cmdCh <- batchPlaceCmd{reqs: reqs, userID: userID, groupID: groupID, allOrNone: allOrNone, cancelOnPartial: cancelOnPartial, ch: ch}
+	return <-ch
+}
+
 func (e *MarketEngine) CancelOrder(orderID, userID string) error {
 	ch := make(chan error, 1)
 	e.cmdCh <- cancelCmd{orderID: orderID, userID: userID, ch: ch}
@@ -189,32 +831,151 @@ func (e *MarketEngine) ResolveMarket(resolvesTo, adminID string) error {
 	return <-ch
 }
 
+// UpdateInstrument replaces this market's instrument metadata and limits,
+// enforced on every order from the next processOrder call onward.
+func (e *MarketEngine) UpdateInstrument(instrument model.Instrument, adminID string) error {
+	ch := make(chan error, 1)
+	e.cmdCh <- updateInstrumentCmd{instrument: instrument, adminID: adminID, ch: ch}
+	return <-ch
+}
+
+// Suspend blocks new order placement and cancellation for this market.
+// When suspendAt is non-nil the suspension is scheduled for that time
+// instead of taking effect immediately. purge controls whether resting
+// orders are canceled once the suspension takes effect.
+func (e *MarketEngine) Suspend(purge bool, suspendAt *time.Time) error {
+	ch := make(chan error, 1)
+	e.cmdCh <- suspendCmd{purge: purge, suspendAt: suspendAt, ch: ch}
+	return <-ch
+}
+
+// Resume re-enables command processing for a suspended market.
+func (e *MarketEngine) Resume() error {
+	ch := make(chan error, 1)
+	e.cmdCh <- resumeCmd{ch: ch}
+	return <-ch
+}
+
 // ── Process Order ────────────────────────────────────
 
-func (e *MarketEngine) processOrder(userID string, req model.PlaceOrderReq) model.PlaceOrderResult {
-	reject := func(reason string) model.PlaceOrderResult {
-		return model.PlaceOrderResult{Status: model.StatusRejected, Reason: reason}
+// orderPrep is the outcome of validating and matching one order against
+// the book before any database work happens. It is shared by single-order
+// and batch placement so both paths apply identical business rules.
+//
+// terminal is set when the order's fate is already decided (REJECTED, or
+// CANCELED for no-liquidity/FOK) without touching the wallet or the book.
+type orderPrep struct {
+	req        model.PlaceOrderReq
+	tif        model.TimeInForce
+	stp        STPMatches
+	matches    []Match
+	lockNeeded int64
+	expiresAt  *time.Time
+	terminal   *model.PlaceOrderResult
+}
+
+// validateOrder checks req against this market's instrument limits,
+// independent of matching mode. Returns the resolved time-in-force and a
+// non-nil terminal result when req must be rejected outright.
+func (e *MarketEngine) validateOrder(userID string, req model.PlaceOrderReq) (model.TimeInForce, *model.PlaceOrderResult) {
+	reject := func(reason string) (model.TimeInForce, *model.PlaceOrderResult) {
+		return "", &model.PlaceOrderResult{Status: model.StatusRejected, Reason: reason}
 	}
 
-	// Validate
+	instr := e.instrument
 	if req.Type == model.TypeLimit {
 		if req.PriceCents == nil || *req.PriceCents < 1 || *req.PriceCents > 99 {
 			return reject("price must be 1-99")
 		}
+		if *req.PriceCents%instr.PriceTickCents != 0 {
+			return reject(fmt.Sprintf("price must be a multiple of the %dc tick size", instr.PriceTickCents))
+		}
+		if e.lastTradeCents != nil {
+			if bps := bandDistanceBps(*e.lastTradeCents, *req.PriceCents); bps > instr.PriceBandBps {
+				return reject("price outside the allowed band from last trade")
+			}
+		}
+	}
+	if req.Qty < instr.MinQty {
+		return reject(fmt.Sprintf("qty must be >= %d", instr.MinQty))
+	}
+	if req.Qty > instr.MaxQty {
+		return reject(fmt.Sprintf("qty must be <= %d", instr.MaxQty))
+	}
+	if instr.QtyLotSize > 1 && req.Qty%instr.QtyLotSize != 0 {
+		return reject(fmt.Sprintf("qty must be a multiple of the lot size %d", instr.QtyLotSize))
+	}
+	if req.Type == model.TypeLimit {
+		notional := int64(*req.PriceCents) * int64(req.Qty)
+		if notional < instr.MinNotionalCents {
+			return reject(fmt.Sprintf("notional must be >= %d", instr.MinNotionalCents))
+		}
+		if notional > instr.MaxNotionalCents {
+			return reject(fmt.Sprintf("notional must be <= %d", instr.MaxNotionalCents))
+		}
+	}
+	if instr.MaxOpenOrdersPerUser > 0 && e.book.CountOpenByUser(userID) >= instr.MaxOpenOrdersPerUser {
+		return reject(fmt.Sprintf("max open orders per user (%d) reached", instr.MaxOpenOrdersPerUser))
+	}
+
+	tif := req.TimeInForce
+	if tif == "" {
+		tif = model.TIFGTC
+	}
+	if tif == model.TIFGTT && (req.CancelAfterSeconds == nil || *req.CancelAfterSeconds < 1) {
+		return reject("GTT requires cancel_after_seconds >= 1")
+	}
+	if req.PostOnly && req.Type != model.TypeLimit {
+		return reject("post_only only valid for LIMIT orders")
+	}
+	return tif, nil
+}
+
+// prepareOrder validates req against this market's instrument limits and
+// finds its matches (a non-mutating peek at the book), applying self-trade
+// prevention. It performs no DB or book writes. Only used in CONTINUOUS
+// matching mode — EPOCH mode defers matching entirely, see bufferOrder.
+func (e *MarketEngine) prepareOrder(userID string, req model.PlaceOrderReq) orderPrep {
+	reject := func(reason string) orderPrep {
+		return orderPrep{req: req, terminal: &model.PlaceOrderResult{Status: model.StatusRejected, Reason: reason}}
 	}
-	if req.Qty < 1 {
-		return reject("qty must be >= 1")
+	cancel := func(reason string) orderPrep {
+		return orderPrep{req: req, terminal: &model.PlaceOrderResult{Status: model.StatusCanceled, Reason: reason}}
+	}
+
+	tif, terminal := e.validateOrder(userID, req)
+	if terminal != nil {
+		return orderPrep{req: req, terminal: terminal}
 	}
 
-	// Required lock
 	lockNeeded := model.CalcLock(req.Side, req.Type, req.PriceCents, req.Qty, e.feeBps)
 
-	// Find matches in memory (non-mutating peek)
-	matches := e.book.FindMatches(string(req.Side), req.PriceCents, req.Qty, userID)
+	// Find matches in memory (non-mutating peek), applying self-trade prevention
+	stp := e.book.FindMatchesSTP(string(req.Side), req.PriceCents, req.Qty, userID, string(req.SelfTradePrevention))
+	if stp.CancelTaker {
+		return reject("self-trade prevention: order would match against your own resting order")
+	}
+	matches := stp.Matches
+
+	// post_only orders must never cross the book
+	if req.PostOnly && len(matches) > 0 {
+		return reject("post_only order would cross the book")
+	}
 
 	// For MARKET orders, if no matches -> cancel
 	if req.Type == model.TypeMarket && len(matches) == 0 {
-		return model.PlaceOrderResult{Status: model.StatusCanceled, Reason: "no liquidity"}
+		return cancel("no liquidity")
+	}
+
+	// FOK must fill in full immediately or be rejected entirely
+	if tif == model.TIFFOK {
+		filled := 0
+		for _, m := range matches {
+			filled += m.FillQty
+		}
+		if filled < req.Qty {
+			return cancel("FOK: insufficient liquidity to fill immediately")
+		}
 	}
 
 	// For MARKET: tighten lock to actual fills
@@ -230,220 +991,1104 @@ func (e *MarketEngine) processOrder(userID string, req model.PlaceOrderReq) mode
 		lockNeeded = actual
 	}
 
+	var expiresAt *time.Time
+	if tif == model.TIFGTT {
+		t := time.Now().Add(time.Duration(*req.CancelAfterSeconds) * time.Second)
+		expiresAt = &t
+	}
+
+	return orderPrep{req: req, tif: tif, stp: stp, matches: matches, lockNeeded: lockNeeded, expiresAt: expiresAt}
+}
+
+// restEntry is the book entry for an order left resting after execution,
+// along with its GTT expiry if any. The book.Add/scheduleExpiry calls for
+// it are deferred until after the DB transaction commits.
+type restEntry struct {
+	entry     *OrderEntry
+	expiresAt *time.Time
+}
+
+// buildOrderRow computes the Order row for an already-prepared order —
+// its fills, resulting status, resting lock and GTT expiry — without
+// touching the database. Split out from executeOrderInTx so processBatch
+// can build every order in a ladder up front and insert them all with one
+// e.store.BatchInsertOrders call instead of one round trip each.
+func (e *MarketEngine) buildOrderRow(userID string, prep orderPrep) (order *model.Order, rest *restEntry, restingLock int64) {
+	req := prep.req
 	orderID := uuid.New().String()
 	seq := e.nextSeq()
 
 	fillQty := 0
-	for _, m := range matches {
+	for _, m := range prep.matches {
 		fillQty += m.FillQty
 	}
 	remainingQty := req.Qty - fillQty
 
-	// Determine status
+	// IOC never rests: whatever isn't filled immediately is canceled.
+	noRest := req.Type == model.TypeMarket || prep.tif == model.TIFIOC
+
 	var status model.OrderStatus
 	switch {
 	case fillQty == req.Qty:
 		status = model.StatusFilled
-	case fillQty > 0 && req.Type == model.TypeLimit:
+	case fillQty > 0 && !noRest:
 		status = model.StatusPartial
-	case fillQty > 0 && req.Type == model.TypeMarket:
+	case fillQty > 0 && noRest:
 		status = model.StatusFilled // remainder canceled
 		remainingQty = 0
-	case req.Type == model.TypeLimit:
+	case !noRest:
 		status = model.StatusOpen
 	default:
 		status = model.StatusCanceled
 	}
 
-	// Resting lock (for LIMIT orders that rest on book)
-	restingLock := int64(0)
 	if (status == model.StatusOpen || status == model.StatusPartial) && remainingQty > 0 {
 		restingLock = model.CalcLock(req.Side, model.TypeLimit, req.PriceCents, remainingQty, e.feeBps)
 	}
 
-	// ── DB Transaction ───────────────────────────────
-	ctx := context.Background()
-	tx, err := e.store.BeginTx(ctx)
-	if err != nil {
-		return reject("internal error")
-	}
-	defer tx.Rollback()
-
-	// Lock wallet
-	wallet, err := e.store.GetWalletForUpdate(tx, userID)
-	if err != nil {
-		return reject("wallet not found")
-	}
-	if wallet.Available() < lockNeeded {
-		return reject(fmt.Sprintf("insufficient balance: need %d, have %d", lockNeeded, wallet.Available()))
-	}
-
-	// Lock funds
-	if err := db.WalletAddLocked(tx, userID, lockNeeded); err != nil {
-		return reject("lock failed")
+	var expiresAt *time.Time
+	if prep.expiresAt != nil && (status == model.StatusOpen || status == model.StatusPartial) && remainingQty > 0 {
+		expiresAt = prep.expiresAt
 	}
 
-	// Insert order
-	order := &model.Order{
+	order = &model.Order{
 		ID: orderID, MarketID: e.marketID, UserID: userID,
 		Side: req.Side, OrderType: req.Type, PriceCents: req.PriceCents,
 		Qty: req.Qty, RemainingQty: remainingQty,
 		LockedCents: restingLock, Status: status, Seq: seq,
 		ClientOrderID: req.ClientOrderID,
+		TimeInForce:   prep.tif,
+		PostOnly:      req.PostOnly,
+		ExpiresAt:     expiresAt,
 	}
-	if err := db.InsertOrder(tx, order); err != nil {
-		return reject("order insert failed: " + err.Error())
-	}
-
-	// Event: OrderAccepted
-	db.AppendEvent(tx, &e.marketID, &seq, "OrderAccepted", map[string]any{
-		"order_id": orderID, "side": req.Side, "type": req.Type,
-		"price": req.PriceCents, "qty": req.Qty, "user_id": userID,
-	})
-
-	// Process fills
-	var trades []model.Trade
-	affectedUsers := map[string]bool{userID: true}
 
-	for _, m := range matches {
-		tradeSeq := e.nextSeq()
-		tradeID := uuid.New().String()
-		ep := m.FillPrice
-		fq := m.FillQty
-		fee := model.CalcTakerFee(ep, fq, e.feeBps)
+	if (status == model.StatusOpen || status == model.StatusPartial) && remainingQty > 0 {
+		entry := &OrderEntry{
+			OrderID:      orderID,
+			UserID:       userID,
+			Side:         string(req.Side),
+			PriceCents:   *req.PriceCents,
+			RemainingQty: remainingQty,
+			LockedCents:  restingLock,
+			Seq:          seq,
+		}
+		if req.DisplayQty > 0 && req.DisplayQty < remainingQty {
+			entry.initIceberg(remainingQty, req.DisplayQty)
+		}
+		rest = &restEntry{
+			entry:     entry,
+			expiresAt: expiresAt,
+		}
+	}
+
+	return order, rest, restingLock
+}
+
+// finishOrderInTx completes an order row already written to orders
+// (by executeOrderInTx's own InsertOrder call, or by processBatch's
+// shared e.store.BatchInsertOrders call): it cancels any STP-flagged makers,
+// books every match via applyMatch, and releases the order's own excess
+// lock (its lockNeeded minus whatever stays locked for its resting
+// remainder).
+func (e *MarketEngine) finishOrderInTx(tx store.Tx, userID string, prep orderPrep, order *model.Order, rest *restEntry, restingLock int64, affectedUsers map[string]bool) (model.PlaceOrderResult, []model.Trade, *restEntry, error) {
+	req := prep.req
+	orderID := order.ID
+
+	// Self-trade prevention: cancel any flagged maker orders in the same tx
+	for _, makerID := range prep.stp.CancelMakerID {
+		if err := e.cancelForSTP(tx, makerID); err != nil {
+			return model.PlaceOrderResult{}, nil, nil, fmt.Errorf("stp maker cancel failed: %w", err)
+		}
+	}
+
+	e.store.PublishEvent(tx, &e.marketID, model.TopicOrderPlaced, model.OrderPlacedPayload{
+		OrderID: orderID, Side: string(req.Side), Type: string(req.Type),
+		Price: req.PriceCents, Qty: req.Qty, UserID: userID,
+	})
+
+	var trades []model.Trade
+	for _, m := range prep.matches {
+		trade, err := e.applyMatch(tx, m, req, userID, orderID)
+		if err != nil {
+			return model.PlaceOrderResult{}, nil, nil, err
+		}
+		trades = append(trades, trade)
+		affectedUsers[m.Entry.UserID] = true
+	}
+
+	// Release this order's excess lock: locked lockNeeded, keeping restingLock
+	takerRelease := prep.lockNeeded - restingLock
+	if err := e.store.WalletAddLocked(tx, userID, -takerRelease); err != nil {
+		return model.PlaceOrderResult{}, nil, nil, fmt.Errorf("taker unlock failed: %w", err)
+	}
+
+	return model.PlaceOrderResult{OrderID: orderID, Status: order.Status, Trades: trades}, trades, rest, nil
+}
+
+// executeOrderInTx books one already-prepared order inside tx: inserts
+// the order row, cancels any STP-flagged makers, applies every match via
+// applyMatch, and releases the order's own excess lock (its lockNeeded
+// minus whatever stays locked for its resting remainder). The caller is
+// responsible for reserving lockNeeded in the wallet beforehand, committing
+// the tx, and adding the returned resting entry to the book afterward.
+func (e *MarketEngine) executeOrderInTx(tx store.Tx, userID string, prep orderPrep, affectedUsers map[string]bool) (model.PlaceOrderResult, []model.Trade, *restEntry, error) {
+	order, rest, restingLock := e.buildOrderRow(userID, prep)
+	if err := e.store.InsertOrder(tx, order); err != nil {
+		return model.PlaceOrderResult{}, nil, nil, fmt.Errorf("order insert failed: %w", err)
+	}
+	return e.finishOrderInTx(tx, userID, prep, order, rest, restingLock, affectedUsers)
+}
+
+// applyMatch books one fill within tx: updates the maker order, both
+// wallets and positions, the platform fee, the trade row and audit event,
+// and folds the fill into the live kline bar. Shared by single-order and
+// batch placement so a fill is booked identically either way.
+func (e *MarketEngine) applyMatch(tx store.Tx, m Match, req model.PlaceOrderReq, userID, orderID string) (model.Trade, error) {
+	tradeSeq := e.nextSeq()
+	tradeID := uuid.New().String()
+	ep := m.FillPrice
+	fq := m.FillQty
+	fee := model.CalcTakerFee(ep, fq, e.feeBps)
+
+	// Maker order update
+	makerEntry := m.Entry
+	e.book.ApplyFill(makerEntry.OrderID, fq)
+	makerNewRem := makerEntry.RemainingQty
+	makerStatus := model.StatusPartial
+	if makerNewRem == 0 {
+		makerStatus = model.StatusFilled
+	}
+	// Proportional lock release for maker
+	makerLockRelease := makerEntry.LockedCents
+	if makerNewRem > 0 {
+		makerLockRelease = makerEntry.LockedCents * int64(fq) / int64(makerNewRem+fq)
+	}
+	makerEntry.LockedCents -= makerLockRelease
+
+	if err := e.store.UpdateOrderFill(tx, makerEntry.OrderID, makerNewRem, makerEntry.LockedCents, makerStatus); err != nil {
+		return model.Trade{}, fmt.Errorf("maker update failed")
+	}
+
+	// Maker wallet: release lock + cash delta
+	if err := e.store.WalletAddLocked(tx, makerEntry.UserID, -makerLockRelease); err != nil {
+		return model.Trade{}, fmt.Errorf("maker wallet failed")
+	}
+	makerCash := int64(ep) * int64(fq)
+	if makerEntry.Side == "BUY" {
+		makerCash = -makerCash // buyer pays
+	}
+	if err := e.store.WalletAddBalance(tx, makerEntry.UserID, makerCash); err != nil {
+		return model.Trade{}, fmt.Errorf("maker balance failed")
+	}
+
+	// Maker position
+	makerSharesDelta := fq
+	if makerEntry.Side == "SELL" {
+		makerSharesDelta = -fq
+	}
+	if err := e.store.UpsertPosition(tx, e.marketID, makerEntry.UserID, makerSharesDelta); err != nil {
+		return model.Trade{}, fmt.Errorf("maker position failed")
+	}
+
+	// Taker wallet: cash delta
+	takerCash := int64(0)
+	if req.Side == model.SideBuy {
+		takerCash = -(int64(ep)*int64(fq) + fee)
+	} else {
+		takerCash = int64(ep)*int64(fq) - fee
+	}
+	if err := e.store.WalletAddBalance(tx, userID, takerCash); err != nil {
+		return model.Trade{}, fmt.Errorf("taker balance failed")
+	}
+
+	// Taker position
+	takerSharesDelta := fq
+	if req.Side == model.SideSell {
+		takerSharesDelta = -fq
+	}
+	if err := e.store.UpsertPosition(tx, e.marketID, userID, takerSharesDelta); err != nil {
+		return model.Trade{}, fmt.Errorf("taker position failed")
+	}
+
+	// Platform fee
+	if fee > 0 {
+		if err := e.store.AddPlatformFee(tx, fee); err != nil {
+			return model.Trade{}, fmt.Errorf("fee failed")
+		}
+	}
+
+	// Trade row
+	trade := &model.Trade{
+		ID: tradeID, MarketID: e.marketID,
+		MakerOrderID: makerEntry.OrderID, TakerOrderID: orderID,
+		MakerUserID: makerEntry.UserID, TakerUserID: userID,
+		PriceCents: ep, Qty: fq, FeeCents: fee, Seq: tradeSeq,
+	}
+	if err := e.store.InsertTrade(tx, trade); err != nil {
+		return model.Trade{}, fmt.Errorf("trade insert failed")
+	}
+	e.recordTrade(ep, fq, time.Now())
+	e.lastTradeCents = &ep
+
+	e.store.PublishEvent(tx, &e.marketID, model.TopicOrderFilled, model.OrderFilledPayload{
+		TradeID: tradeID, Price: ep, Qty: fq, FeeCents: fee,
+		TakerSide: string(req.Side), MakerOrder: makerEntry.OrderID,
+	})
+
+	return *trade, nil
+}
+
+// lookupByClientOrderID returns the result of a previously placed order
+// sharing the same ClientOrderID, so a retried PlaceOrder call (e.g. from
+// Manager.PlaceOrderWithRetry after a transient failure) replays the
+// original outcome instead of risking a duplicate order.
+func (e *MarketEngine) lookupByClientOrderID(userID, clientOrderID string) (model.PlaceOrderResult, bool) {
+	existing, err := e.store.GetOrderByClientID(context.Background(), e.marketID, userID, clientOrderID)
+	if err != nil || existing == nil {
+		return model.PlaceOrderResult{}, false
+	}
+	trades, err := e.store.GetTradesForOrder(context.Background(), existing.ID)
+	if err != nil {
+		trades = nil
+	}
+	return model.PlaceOrderResult{OrderID: existing.ID, Status: existing.Status, Trades: trades}, true
+}
+
+func (e *MarketEngine) processOrder(userID string, req model.PlaceOrderReq) model.PlaceOrderResult {
+	if e.suspended {
+		return model.PlaceOrderResult{Status: model.StatusRejected, Reason: "market suspended"}
+	}
+	if req.ClientOrderID != nil {
+		if result, found := e.lookupByClientOrderID(userID, *req.ClientOrderID); found {
+			return result
+		}
+	}
+	if e.matchingMode == model.ModeEpoch {
+		return e.bufferOrder(userID, req)
+	}
+
+	prep := e.prepareOrder(userID, req)
+	if prep.terminal != nil {
+		return *prep.terminal
+	}
+
+	reject := func(reason string) model.PlaceOrderResult {
+		return model.PlaceOrderResult{Status: model.StatusRejected, Reason: reason}
+	}
+
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return reject("internal error")
+	}
+	defer tx.Rollback()
+
+	wallet, err := e.store.GetWalletForUpdate(tx, userID)
+	if err != nil {
+		return reject("wallet not found")
+	}
+	if e.hedgeSiblings != nil {
+		if siblings := e.hedgeSiblings(e.marketID); len(siblings) > 0 {
+			positions, err := e.store.GetPositionsForUpdate(tx, userID, siblings)
+			if err != nil {
+				return reject("hedge lookup failed")
+			}
+			hedgePositions := make([]model.HedgePosition, len(positions))
+			for i, p := range positions {
+				hedgePositions[i] = model.HedgePosition{MarketID: p.MarketID, YesShares: p.YesShares}
+			}
+			prep.lockNeeded = model.CalcLockWithHedge(req.Side, req.Type, req.PriceCents, req.Qty, e.feeBps, e.hedgeKind(e.marketID), hedgePositions)
+		}
+	}
+	if wallet.Available() < prep.lockNeeded {
+		return reject(fmt.Sprintf("insufficient balance: need %d, have %d", prep.lockNeeded, wallet.Available()))
+	}
+	if err := e.store.WalletAddLocked(tx, userID, prep.lockNeeded); err != nil {
+		return reject("lock failed")
+	}
+
+	affectedUsers := map[string]bool{userID: true}
+	result, trades, rest, err := e.executeOrderInTx(tx, userID, prep, affectedUsers)
+	if err != nil {
+		return reject(err.Error())
+	}
+
+	for uid := range affectedUsers {
+		if err := e.store.RecalcLocked(tx, uid); err != nil {
+			return reject("recalc failed: " + err.Error())
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return reject("commit failed: " + err.Error())
+	}
+
+	// Add resting order to in-memory book (after commit)
+	if rest != nil {
+		e.book.Add(rest.entry)
+		if rest.expiresAt != nil {
+			e.scheduleExpiry(rest.entry.OrderID, *rest.expiresAt)
+		}
+	}
+
+	if e.publish != nil {
+		bids, asks := e.book.Snapshot(20)
+		e.publish(e.marketID, "book_snapshot", map[string]any{"bids": bids, "asks": asks})
+		for _, t := range trades {
+			e.publish(e.marketID, "trade", t)
+		}
+		for _, makerID := range prep.stp.CancelMakerID {
+			e.publish(e.marketID, "order_canceled", map[string]any{"order_id": makerID, "reason": "self_trade_prevention"})
+		}
+		if len(trades) > 0 && e.hedgeSiblings != nil {
+			for _, sibID := range e.hedgeSiblings(e.marketID) {
+				e.publish(sibID, "hedge_group_update", map[string]any{"user_id": userID, "trigger_market_id": e.marketID})
+			}
+		}
+	}
+
+	if e.onMakerFill != nil {
+		for _, t := range trades {
+			e.onMakerFill(t.MakerOrderID, !e.book.Contains(t.MakerOrderID))
+		}
+	}
+
+	return result
+}
+
+// processBatch places every req from one user within a single engine tick
+// and DB transaction: the aggregate lock across all valid orders is
+// reserved once, then the existing per-order matching logic runs for each
+// in turn. Orders within the same batch are matched against the resting
+// book as it stood when the batch started — they cannot cross each other,
+// which fits the laddering use case this exists for.
+func (e *MarketEngine) processBatch(userID string, reqs []model.PlaceOrderReq, groupID string, allOrNone, cancelOnPartial bool) model.BatchPlaceOrderResult {
+	if groupID == "" {
+		groupID = uuid.New().String()
+	}
+	rejectAll := func(reason string) model.BatchPlaceOrderResult {
+		results := make([]model.PlaceOrderResult, len(reqs))
+		for i := range results {
+			results[i] = model.PlaceOrderResult{Status: model.StatusRejected, Reason: reason}
+		}
+		return model.BatchPlaceOrderResult{GroupID: groupID, Results: results}
+	}
+
+	preps := make([]orderPrep, len(reqs))
+	for i, req := range reqs {
+		preps[i] = e.prepareOrder(userID, req)
+	}
+
+	if allOrNone {
+		for i, p := range preps {
+			if p.terminal != nil && p.terminal.Status == model.StatusRejected {
+				return rejectAll(fmt.Sprintf("batch aborted: order %d rejected: %s", i, p.terminal.Reason))
+			}
+		}
+	}
+
+	var aggregateLock int64
+	for _, p := range preps {
+		if p.terminal == nil {
+			aggregateLock += p.lockNeeded
+		}
+	}
+
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return rejectAll("internal error")
+	}
+	defer tx.Rollback()
+
+	wallet, err := e.store.GetWalletForUpdate(tx, userID)
+	if err != nil {
+		return rejectAll("wallet not found")
+	}
+	if wallet.Available() < aggregateLock {
+		return rejectAll(fmt.Sprintf("insufficient balance: need %d, have %d", aggregateLock, wallet.Available()))
+	}
+	if aggregateLock > 0 {
+		if err := e.store.WalletAddLocked(tx, userID, aggregateLock); err != nil {
+			return rejectAll("lock failed")
+		}
+	}
+
+	// Build every non-terminal order row up front and insert them all in
+	// one e.store.BatchInsertOrders call, instead of one InsertOrder round trip
+	// per leg of the ladder.
+	orders := make([]*model.Order, len(preps))
+	restsPending := make([]*restEntry, len(preps))
+	restingLocks := make([]int64, len(preps))
+	var toInsert []*model.Order
+	for i, prep := range preps {
+		if prep.terminal != nil {
+			continue
+		}
+		order, rest, restingLock := e.buildOrderRow(userID, prep)
+		orders[i] = order
+		restsPending[i] = rest
+		restingLocks[i] = restingLock
+		toInsert = append(toInsert, order)
+	}
+	if err := e.store.BatchInsertOrders(tx, toInsert); err != nil {
+		return rejectAll("batch order insert failed: " + err.Error())
+	}
+
+	results := make([]model.PlaceOrderResult, len(reqs))
+	rests := make([]*restEntry, len(reqs))
+	var allTrades []model.Trade
+	affectedUsers := map[string]bool{userID: true}
+
+	for i, prep := range preps {
+		if prep.terminal != nil {
+			results[i] = *prep.terminal
+			continue
+		}
+		result, trades, rest, err := e.finishOrderInTx(tx, userID, prep, orders[i], restsPending[i], restingLocks[i], affectedUsers)
+		if err != nil {
+			return rejectAll(err.Error())
+		}
+		results[i] = result
+		rests[i] = rest
+		allTrades = append(allTrades, trades...)
+	}
+
+	// cancel_on_partial: if anything is left resting, cancel every resting
+	// leg in the same tx rather than letting a half-filled ladder stand.
+	if cancelOnPartial {
+		for i, rest := range rests {
+			if rest == nil {
+				continue
+			}
+			if _, err := e.store.CancelOrderTx(tx, rest.entry.OrderID); err != nil {
+				return rejectAll("cancel_on_partial cleanup failed: " + err.Error())
+			}
+			if err := e.store.WalletAddLocked(tx, userID, -rest.entry.LockedCents); err != nil {
+				return rejectAll("cancel_on_partial cleanup failed: " + err.Error())
+			}
+			e.store.AppendEvent(tx, &e.marketID, nil, "OrderCanceledBatchPartial", map[string]any{
+				"order_id": rest.entry.OrderID, "user_id": userID, "group_id": groupID,
+			})
+			results[i].Status = model.StatusCanceled
+			results[i].Reason = "canceled: batch left a partial ladder (cancel_on_partial)"
+			rests[i] = nil
+		}
+	}
+
+	for uid := range affectedUsers {
+		if err := e.store.RecalcLocked(tx, uid); err != nil {
+			return rejectAll("recalc failed: " + err.Error())
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return rejectAll("commit failed: " + err.Error())
+	}
+
+	for _, rest := range rests {
+		if rest == nil {
+			continue
+		}
+		e.book.Add(rest.entry)
+		if rest.expiresAt != nil {
+			e.scheduleExpiry(rest.entry.OrderID, *rest.expiresAt)
+		}
+	}
+
+	if e.publish != nil {
+		bids, asks := e.book.Snapshot(20)
+		e.publish(e.marketID, "book_snapshot", map[string]any{"bids": bids, "asks": asks})
+		for _, t := range allTrades {
+			e.publish(e.marketID, "trade", t)
+		}
+		for _, prep := range preps {
+			for _, makerID := range prep.stp.CancelMakerID {
+				e.publish(e.marketID, "order_canceled", map[string]any{"order_id": makerID, "reason": "self_trade_prevention"})
+			}
+		}
+		e.publish(e.marketID, "batch_ack", map[string]any{"group_id": groupID, "order_count": len(reqs)})
+	}
+
+	if e.onMakerFill != nil {
+		for _, t := range allTrades {
+			e.onMakerFill(t.MakerOrderID, !e.book.Contains(t.MakerOrderID))
+		}
+	}
+
+	return model.BatchPlaceOrderResult{GroupID: groupID, Results: results}
+}
+
+// ── Epoch Batch Auction ──────────────────────────────
+
+// bufferOrder accepts an order in EPOCH matching mode without attempting
+// to match it: it validates and locks funds exactly like a resting
+// CONTINUOUS order, then rests on the book untouched until the next
+// epoch's auction clears it. MARKET orders and IOC/FOK/post-only orders
+// all assume immediate matching, so none of them make sense here.
+func (e *MarketEngine) bufferOrder(userID string, req model.PlaceOrderReq) model.PlaceOrderResult {
+	reject := func(reason string) model.PlaceOrderResult {
+		return model.PlaceOrderResult{Status: model.StatusRejected, Reason: reason}
+	}
+
+	if req.Type != model.TypeLimit {
+		return reject("EPOCH matching mode only accepts LIMIT orders")
+	}
+	if req.PostOnly {
+		return reject("post_only has no meaning in EPOCH matching mode")
+	}
+	switch req.TimeInForce {
+	case "", model.TIFGTC, model.TIFGTT:
+	default:
+		return reject("EPOCH matching mode only supports GTC or GTT orders")
+	}
+
+	tif, terminal := e.validateOrder(userID, req)
+	if terminal != nil {
+		return *terminal
+	}
+
+	lockNeeded := model.CalcLock(req.Side, req.Type, req.PriceCents, req.Qty, e.feeBps)
+
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return reject("internal error")
+	}
+	defer tx.Rollback()
+
+	wallet, err := e.store.GetWalletForUpdate(tx, userID)
+	if err != nil {
+		return reject("wallet not found")
+	}
+	if wallet.Available() < lockNeeded {
+		return reject(fmt.Sprintf("insufficient balance: need %d, have %d", lockNeeded, wallet.Available()))
+	}
+	if err := e.store.WalletAddLocked(tx, userID, lockNeeded); err != nil {
+		return reject("lock failed")
+	}
+
+	orderID := uuid.New().String()
+	seq := e.nextSeq()
+	var expiresAt *time.Time
+	if tif == model.TIFGTT {
+		t := time.Now().Add(time.Duration(*req.CancelAfterSeconds) * time.Second)
+		expiresAt = &t
+	}
+	order := &model.Order{
+		ID: orderID, MarketID: e.marketID, UserID: userID,
+		Side: req.Side, OrderType: req.Type, PriceCents: req.PriceCents,
+		Qty: req.Qty, RemainingQty: req.Qty,
+		LockedCents: lockNeeded, Status: model.StatusOpen, Seq: seq,
+		ClientOrderID: req.ClientOrderID,
+		TimeInForce:   tif,
+		ExpiresAt:     expiresAt,
+	}
+	if err := e.store.InsertOrder(tx, order); err != nil {
+		return reject("order insert failed: " + err.Error())
+	}
+	e.store.AppendEvent(tx, &e.marketID, &seq, "OrderBufferedForEpoch", map[string]any{
+		"order_id": orderID, "epoch_id": e.epochID, "side": req.Side,
+		"price": req.PriceCents, "qty": req.Qty, "user_id": userID,
+	})
+	if err := tx.Commit(); err != nil {
+		return reject("commit failed: " + err.Error())
+	}
+
+	e.book.Add(&OrderEntry{
+		OrderID:      orderID,
+		UserID:       userID,
+		Side:         string(req.Side),
+		PriceCents:   *req.PriceCents,
+		RemainingQty: req.Qty,
+		LockedCents:  lockNeeded,
+		Seq:          seq,
+	})
+	if expiresAt != nil {
+		e.scheduleExpiry(orderID, *expiresAt)
+	}
+
+	if e.publish != nil {
+		bids, asks := e.book.Snapshot(20)
+		e.publish(e.marketID, "book_snapshot", map[string]any{"bids": bids, "asks": asks})
+	}
+
+	return model.PlaceOrderResult{OrderID: orderID, Status: model.StatusOpen, Reason: "queued for next epoch auction"}
+}
+
+// startEpoch opens a new epoch: it picks a fresh random epoch id, derives
+// from it the seed used later to break same-price ties fairly, and
+// schedules the timer that will run this epoch's auction once
+// epochDurationMs elapses.
+func (e *MarketEngine) startEpoch() {
+	e.epochID = uuid.New().String()
+	idSum := sha256.Sum256([]byte(e.epochID))
+	e.epochSeed = int64(binary.BigEndian.Uint64(idSum[:8]))
+	e.epochStartAt = time.Now()
+	e.epochEndAt = e.epochStartAt.Add(time.Duration(e.epochDurationMs) * time.Millisecond)
+	e.epochCutoffAt = e.epochEndAt.Add(-epochCancelCutoff)
+	if e.epochCutoffAt.Before(e.epochStartAt) {
+		e.epochCutoffAt = e.epochStartAt
+	}
+
+	epochID := e.epochID
+	time.AfterFunc(time.Until(e.epochEndAt), func() {
+		e.cmdCh <- epochTickCmd{epochID: epochID}
+	})
+
+	seq := e.nextSeq()
+	if tx, err := e.store.BeginTx(context.Background()); err == nil {
+		e.store.AppendEvent(tx, &e.marketID, &seq, "EpochStarted", map[string]any{
+			"epoch_id": e.epochID, "seed": e.epochSeed, "ends_at": e.epochEndAt,
+		})
+		tx.Commit()
+	}
+	if e.publish != nil {
+		e.publish(e.marketID, "epoch_start", map[string]any{
+			"epoch_id": e.epochID, "starts_at": e.epochStartAt, "ends_at": e.epochEndAt,
+		})
+	}
+}
+
+// auctionFill is one matched quantity between a resting buy and a resting
+// sell order, cleared at the epoch's single uniform price.
+type auctionFill struct {
+	buy  *OrderEntry
+	sell *OrderEntry
+	qty  int
+}
+
+// runEpochAuction clears the whole book in a single sealed-bid
+// uniform-price auction: find the price that maximizes crossing quantity,
+// fill every crossing order at that one price, and leave the remainder
+// resting for the next epoch. Tie-breaks within a price level use a
+// shuffle seeded by the epoch id so no submitter gets deterministic
+// priority from arrival order alone.
+func (e *MarketEngine) runEpochAuction() {
+	epochID, seed := e.epochID, e.epochSeed
+	startedAt, endedAt := e.epochStartAt, time.Now()
+
+	bids := e.book.AllBids()
+	asks := e.book.AllAsks()
+	participantIDs := make([]string, 0, len(bids)+len(asks))
+	for _, o := range bids {
+		participantIDs = append(participantIDs, o.OrderID)
+	}
+	for _, o := range asks {
+		participantIDs = append(participantIDs, o.OrderID)
+	}
+
+	var clearing, matchQty int
+	var fills []auctionFill
+	if len(bids) > 0 && len(asks) > 0 {
+		rng := rand.New(rand.NewSource(seed))
+		shuffleWithinPrice(bids, rng)
+		shuffleWithinPrice(asks, rng)
+		clearing, matchQty = clearingPriceAndQty(bids, asks)
+		if matchQty > 0 {
+			fills = pairAuctionFills(bids, asks, clearing, matchQty)
+		}
+	}
+
+	var trades []model.Trade
+	if len(fills) > 0 {
+		if committed := e.commitAuctionFills(fills, clearing, &trades); !committed {
+			trades = nil
+			matchQty = 0
+		}
+	}
+
+	var clearingCents *int
+	if matchQty > 0 {
+		c := clearing
+		clearingCents = &c
+	}
+	hash := hashOrderIDs(participantIDs)
+	e.persistEpoch(&model.Epoch{
+		ID: epochID, MarketID: e.marketID, Seed: seed,
+		ClearingCents: clearingCents, MatchedQty: matchQty,
+		OrderIDsHash: hash, StartedAt: startedAt, EndedAt: endedAt,
+	})
+
+	if e.publish != nil {
+		e.publish(e.marketID, "epoch_match_report", map[string]any{
+			"epoch_id": epochID, "clearing_cents": clearingCents,
+			"matched_qty": matchQty, "trades": trades,
+		})
+		bids2, asks2 := e.book.Snapshot(20)
+		e.publish(e.marketID, "book_snapshot", map[string]any{"bids": bids2, "asks": asks2})
+		e.publish(e.marketID, "epoch_end", map[string]any{"epoch_id": epochID})
+	}
+}
+
+// commitAuctionFills books every fill in one transaction. Returns false
+// (with nothing committed) if any step fails.
+func (e *MarketEngine) commitAuctionFills(fills []auctionFill, clearing int, trades *[]model.Trade) bool {
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		log.Printf("[engine] market %s: epoch auction begin tx failed: %v", e.marketID, err)
+		return false
+	}
+	defer tx.Rollback()
+
+	affectedUsers := map[string]bool{}
+	for _, f := range fills {
+		trade, err := e.applyAuctionFill(tx, f.buy, f.sell, f.qty, clearing)
+		if err != nil {
+			log.Printf("[engine] market %s: epoch auction fill failed: %v", e.marketID, err)
+			return false
+		}
+		*trades = append(*trades, trade)
+		affectedUsers[f.buy.UserID] = true
+		affectedUsers[f.sell.UserID] = true
+	}
+	for uid := range affectedUsers {
+		if err := e.store.RecalcLocked(tx, uid); err != nil {
+			log.Printf("[engine] market %s: epoch auction recalc failed: %v", e.marketID, err)
+			return false
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[engine] market %s: epoch auction commit failed: %v", e.marketID, err)
+		return false
+	}
+	return true
+}
+
+// applyAuctionFill books one fill between two resting orders at the
+// epoch's single clearing price. Unlike a continuous-mode fill, neither
+// side is a "taker" — both pay the taker fee independently, since a batch
+// auction has no aggressor to assign it to.
+func (e *MarketEngine) applyAuctionFill(tx store.Tx, buy, sell *OrderEntry, qty, price int) (model.Trade, error) {
+	fee := model.CalcTakerFee(price, qty, e.feeBps)
+
+	e.book.ApplyFill(buy.OrderID, qty)
+	buyRem := buy.RemainingQty
+	buyStatus := model.StatusPartial
+	if buyRem == 0 {
+		buyStatus = model.StatusFilled
+	}
+	buyLockRelease := buy.LockedCents
+	if buyRem > 0 {
+		buyLockRelease = buy.LockedCents * int64(qty) / int64(buyRem+qty)
+	}
+	buy.LockedCents -= buyLockRelease
+	if err := e.store.UpdateOrderFill(tx, buy.OrderID, buyRem, buy.LockedCents, buyStatus); err != nil {
+		return model.Trade{}, fmt.Errorf("buy update failed")
+	}
+	if err := e.store.WalletAddLocked(tx, buy.UserID, -buyLockRelease); err != nil {
+		return model.Trade{}, fmt.Errorf("buy wallet failed")
+	}
+	if err := e.store.WalletAddBalance(tx, buy.UserID, -(int64(price)*int64(qty) + fee)); err != nil {
+		return model.Trade{}, fmt.Errorf("buy balance failed")
+	}
+	if err := e.store.UpsertPosition(tx, e.marketID, buy.UserID, qty); err != nil {
+		return model.Trade{}, fmt.Errorf("buy position failed")
+	}
 
-		// Maker order update
-		makerEntry := m.Entry
-		e.book.ApplyFill(makerEntry.OrderID, fq)
-		makerNewRem := makerEntry.RemainingQty
-		makerStatus := model.StatusPartial
-		if makerNewRem == 0 {
-			makerStatus = model.StatusFilled
-		}
-		// Proportional lock release for maker
-		makerLockRelease := makerEntry.LockedCents
-		if makerNewRem > 0 {
-			makerLockRelease = makerEntry.LockedCents * int64(fq) / int64(makerNewRem+fq)
+	e.book.ApplyFill(sell.OrderID, qty)
+	sellRem := sell.RemainingQty
+	sellStatus := model.StatusPartial
+	if sellRem == 0 {
+		sellStatus = model.StatusFilled
+	}
+	sellLockRelease := sell.LockedCents
+	if sellRem > 0 {
+		sellLockRelease = sell.LockedCents * int64(qty) / int64(sellRem+qty)
+	}
+	sell.LockedCents -= sellLockRelease
+	if err := e.store.UpdateOrderFill(tx, sell.OrderID, sellRem, sell.LockedCents, sellStatus); err != nil {
+		return model.Trade{}, fmt.Errorf("sell update failed")
+	}
+	if err := e.store.WalletAddLocked(tx, sell.UserID, -sellLockRelease); err != nil {
+		return model.Trade{}, fmt.Errorf("sell wallet failed")
+	}
+	if err := e.store.WalletAddBalance(tx, sell.UserID, int64(price)*int64(qty)-fee); err != nil {
+		return model.Trade{}, fmt.Errorf("sell balance failed")
+	}
+	if err := e.store.UpsertPosition(tx, e.marketID, sell.UserID, -qty); err != nil {
+		return model.Trade{}, fmt.Errorf("sell position failed")
+	}
+
+	totalFee := fee * 2
+	if totalFee > 0 {
+		if err := e.store.AddPlatformFee(tx, totalFee); err != nil {
+			return model.Trade{}, fmt.Errorf("fee failed")
 		}
-		makerEntry.LockedCents -= makerLockRelease
+	}
+
+	tradeID := uuid.New().String()
+	tradeSeq := e.nextSeq()
+	trade := &model.Trade{
+		ID: tradeID, MarketID: e.marketID,
+		MakerOrderID: sell.OrderID, TakerOrderID: buy.OrderID,
+		MakerUserID: sell.UserID, TakerUserID: buy.UserID,
+		PriceCents: price, Qty: qty, FeeCents: totalFee, Seq: tradeSeq,
+	}
+	if err := e.store.InsertTrade(tx, trade); err != nil {
+		return model.Trade{}, fmt.Errorf("trade insert failed")
+	}
+	e.recordTrade(price, qty, time.Now())
+	e.lastTradeCents = &price
+
+	e.store.AppendEvent(tx, &e.marketID, &tradeSeq, "TradeExecuted", map[string]any{
+		"trade_id": tradeID, "price": price, "qty": qty, "fee": totalFee,
+		"epoch_id": e.epochID, "buy_order": buy.OrderID, "sell_order": sell.OrderID,
+	})
+	return *trade, nil
+}
+
+// persistEpoch records one completed auction round for audit, independent
+// of whether any fills actually committed.
+func (e *MarketEngine) persistEpoch(ep *model.Epoch) {
+	tx, err := e.store.BeginTx(context.Background())
+	if err != nil {
+		log.Printf("[engine] market %s: epoch %s persist failed: %v", e.marketID, ep.ID, err)
+		return
+	}
+	defer tx.Rollback()
+	if err := e.store.InsertEpoch(tx, ep); err != nil {
+		log.Printf("[engine] market %s: epoch %s persist failed: %v", e.marketID, ep.ID, err)
+		return
+	}
+	seq := e.nextSeq()
+	e.store.AppendEvent(tx, &e.marketID, &seq, "EpochEnded", map[string]any{
+		"epoch_id": ep.ID, "seed": ep.Seed, "clearing_cents": ep.ClearingCents,
+		"matched_qty": ep.MatchedQty, "order_ids_hash": ep.OrderIDsHash,
+	})
+	tx.Commit()
+}
 
-		if err := db.UpdateOrderFill(tx, makerEntry.OrderID, makerNewRem, makerEntry.LockedCents, makerStatus); err != nil {
-			return reject("maker update failed")
+// shuffleWithinPrice randomizes order within each contiguous run of equal
+// PriceCents, without disturbing the across-level price ordering the
+// caller already sorted entries into.
+func shuffleWithinPrice(entries []*OrderEntry, rng *rand.Rand) {
+	i := 0
+	for i < len(entries) {
+		j := i
+		for j < len(entries) && entries[j].PriceCents == entries[i].PriceCents {
+			j++
 		}
+		rng.Shuffle(j-i, func(a, b int) {
+			entries[i+a], entries[i+b] = entries[i+b], entries[i+a]
+		})
+		i = j
+	}
+}
 
-		// Maker wallet: release lock + cash delta
-		if err := db.WalletAddLocked(tx, makerEntry.UserID, -makerLockRelease); err != nil {
-			return reject("maker wallet failed")
+// clearingPriceAndQty finds the price that maximizes crossing quantity
+// between bids (desc by price) and asks (asc by price): for each
+// candidate price, cumulative buy qty at-or-above it vs. cumulative sell
+// qty at-or-below it, take the min, and keep the price maximizing that.
+// When several prices tie for the max, the clearing price is the midpoint
+// of the lowest and highest tied price.
+func clearingPriceAndQty(bids, asks []*OrderEntry) (clearing, qty int) {
+	priceSet := make(map[int]bool)
+	for _, o := range bids {
+		priceSet[o.PriceCents] = true
+	}
+	for _, o := range asks {
+		priceSet[o.PriceCents] = true
+	}
+	prices := make([]int, 0, len(priceSet))
+	for p := range priceSet {
+		prices = append(prices, p)
+	}
+	sort.Ints(prices)
+
+	bestQty := 0
+	var bestPrices []int
+	for _, p := range prices {
+		buyQty, sellQty := 0, 0
+		for _, o := range bids {
+			if o.PriceCents >= p {
+				buyQty += o.RemainingQty
+			}
 		}
-		makerCash := int64(ep) * int64(fq)
-		if makerEntry.Side == "BUY" {
-			makerCash = -makerCash // buyer pays
+		for _, o := range asks {
+			if o.PriceCents <= p {
+				sellQty += o.RemainingQty
+			}
 		}
-		if err := db.WalletAddBalance(tx, makerEntry.UserID, makerCash); err != nil {
-			return reject("maker balance failed")
+		m := min(buyQty, sellQty)
+		switch {
+		case m > bestQty:
+			bestQty = m
+			bestPrices = []int{p}
+		case m == bestQty && m > 0:
+			bestPrices = append(bestPrices, p)
 		}
-
-		// Maker position
-		makerSharesDelta := fq
-		if makerEntry.Side == "SELL" {
-			makerSharesDelta = -fq
+	}
+	if bestQty == 0 {
+		return 0, 0
+	}
+	lo, hi := bestPrices[0], bestPrices[0]
+	for _, p := range bestPrices {
+		if p < lo {
+			lo = p
 		}
-		if err := db.UpsertPosition(tx, e.marketID, makerEntry.UserID, makerSharesDelta); err != nil {
-			return reject("maker position failed")
+		if p > hi {
+			hi = p
 		}
+	}
+	return (lo + hi) / 2, bestQty
+}
 
-		// Taker wallet: cash delta
-		takerCash := int64(0)
-		if req.Side == model.SideBuy {
-			takerCash = -(int64(ep)*int64(fq) + fee)
-		} else {
-			takerCash = int64(ep)*int64(fq) - fee
+// pairAuctionFills walks the (already price-sorted, tie-shuffled) crossing
+// bids and asks and pairs up quantity between them until qty is
+// exhausted, producing the individual buy/sell fills to book.
+func pairAuctionFills(bids, asks []*OrderEntry, clearing, qty int) []auctionFill {
+	var buyQueue, sellQueue []*OrderEntry
+	for _, o := range bids {
+		if o.PriceCents >= clearing {
+			buyQueue = append(buyQueue, o)
 		}
-		if err := db.WalletAddBalance(tx, userID, takerCash); err != nil {
-			return reject("taker balance failed")
+	}
+	for _, o := range asks {
+		if o.PriceCents <= clearing {
+			sellQueue = append(sellQueue, o)
 		}
+	}
 
-		// Taker position
-		takerSharesDelta := fq
-		if req.Side == model.SideSell {
-			takerSharesDelta = -fq
+	var fills []auctionFill
+	bi, si := 0, 0
+	bRem, sRem := 0, 0
+	remaining := qty
+	for remaining > 0 && bi < len(buyQueue) && si < len(sellQueue) {
+		if bRem == 0 {
+			bRem = buyQueue[bi].RemainingQty
 		}
-		if err := db.UpsertPosition(tx, e.marketID, userID, takerSharesDelta); err != nil {
-			return reject("taker position failed")
+		if sRem == 0 {
+			sRem = sellQueue[si].RemainingQty
 		}
-
-		// Platform fee
-		if fee > 0 {
-			if err := db.AddPlatformFee(tx, fee); err != nil {
-				return reject("fee failed")
-			}
+		f := min(min(bRem, sRem), remaining)
+		if f <= 0 {
+			break
 		}
-
-		// Trade row
-		trade := &model.Trade{
-			ID: tradeID, MarketID: e.marketID,
-			MakerOrderID: makerEntry.OrderID, TakerOrderID: orderID,
-			MakerUserID: makerEntry.UserID, TakerUserID: userID,
-			PriceCents: ep, Qty: fq, FeeCents: fee, Seq: tradeSeq,
+		fills = append(fills, auctionFill{buy: buyQueue[bi], sell: sellQueue[si], qty: f})
+		bRem -= f
+		sRem -= f
+		remaining -= f
+		if bRem == 0 {
+			bi++
 		}
-		if err := db.InsertTrade(tx, trade); err != nil {
-			return reject("trade insert failed")
+		if sRem == 0 {
+			si++
 		}
-		trades = append(trades, *trade)
+	}
+	return fills
+}
 
-		db.AppendEvent(tx, &e.marketID, &tradeSeq, "TradeExecuted", map[string]any{
-			"trade_id": tradeID, "price": ep, "qty": fq, "fee": fee,
-			"taker_side": req.Side, "maker_order": makerEntry.OrderID,
-		})
+// hashOrderIDs fingerprints the participating order ids of one epoch so
+// clients can recompute it and verify the engine didn't quietly drop or
+// add a participant after the fact.
+func hashOrderIDs(orderIDs []string) string {
+	sorted := append([]string(nil), orderIDs...)
+	sort.Strings(sorted)
+	sum := sha256.Sum256([]byte(strings.Join(sorted, ",")))
+	return hex.EncodeToString(sum[:])
+}
 
-		affectedUsers[makerEntry.UserID] = true
+// bandDistanceBps returns how far priceCents sits from lastCents, in basis
+// points of the last trade price, used to enforce an instrument's
+// price_band_bps circuit breaker.
+func bandDistanceBps(lastCents, priceCents int) int {
+	if lastCents == 0 {
+		return 0
 	}
+	diff := priceCents - lastCents
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff * 10000 / lastCents
+}
 
-	// Release taker's excess lock: locked lockNeeded, keeping restingLock
-	takerRelease := lockNeeded - restingLock
-	if err := db.WalletAddLocked(tx, userID, -takerRelease); err != nil {
-		return reject("taker unlock failed")
+// cancelForSTP removes a resting order from the book and DB within an
+// in-flight transaction, used when self-trade prevention flags a maker.
+func (e *MarketEngine) cancelForSTP(tx store.Tx, orderID string) error {
+	entry := e.book.Remove(orderID)
+	if entry == nil {
+		return nil
+	}
+	if _, err := e.store.CancelOrderTx(tx, orderID); err != nil {
+		return err
+	}
+	if err := e.store.WalletAddLocked(tx, entry.UserID, -entry.LockedCents); err != nil {
+		return err
 	}
+	seq := e.nextSeq()
+	return e.store.AppendEvent(tx, &e.marketID, &seq, "OrderCanceledSTP", map[string]any{
+		"order_id": orderID, "user_id": entry.UserID,
+	})
+}
 
-	// Recalc locked for all affected users (handles position locks)
-	for uid := range affectedUsers {
-		if err := db.RecalcLocked(tx, uid); err != nil {
-			return reject("recalc failed: " + err.Error())
+// scheduleExpiry arranges for a GTT order to be auto-canceled once its
+// cancel_after_seconds elapses, by sending an expireCmd back through the
+// engine's own command channel so cancellation happens on the engine
+// goroutine like every other mutation.
+func (e *MarketEngine) scheduleExpiry(orderID string, at time.Time) {
+	d := time.Until(at)
+	if d < 0 {
+		d = 0
+	}
+	time.AfterFunc(d, func() {
+		select {
+		case e.cmdCh <- expireCmd{orderID: orderID}:
+		default:
+			log.Printf("[engine] market %s: dropped GTT expiry for %s (cmdCh full)", e.marketID, orderID)
 		}
+	})
+}
+
+// expireOrder cancels a GTT order once its time-in-force has elapsed and
+// emits order_expired to subscribers. Runs on the engine goroutine.
+func (e *MarketEngine) expireOrder(orderID string) {
+	ctx := context.Background()
+	o, err := e.store.GetOrder(ctx, orderID)
+	if err != nil || o == nil || (o.Status != model.StatusOpen && o.Status != model.StatusPartial) {
+		return
 	}
 
-	if err := tx.Commit(); err != nil {
-		return reject("commit failed: " + err.Error())
+	e.book.Remove(orderID)
+
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return
 	}
+	defer tx.Rollback()
 
-	// Add resting order to in-memory book (after commit)
-	if (status == model.StatusOpen || status == model.StatusPartial) && remainingQty > 0 {
-		e.book.Add(&OrderEntry{
-			OrderID:      orderID,
-			UserID:       userID,
-			Side:         string(req.Side),
-			PriceCents:   *req.PriceCents,
-			RemainingQty: remainingQty,
-			LockedCents:  restingLock,
-			Seq:          seq,
-		})
+	if _, err := e.store.CancelOrderTx(tx, orderID); err != nil {
+		return
+	}
+	if err := e.store.WalletAddLocked(tx, o.UserID, -o.LockedCents); err != nil {
+		return
+	}
+	seq := e.nextSeq()
+	e.store.AppendEvent(tx, &e.marketID, &seq, "OrderExpired", map[string]any{
+		"order_id": orderID, "user_id": o.UserID,
+	})
+	if err := tx.Commit(); err != nil {
+		return
 	}
 
-	// Publish WS
 	if e.publish != nil {
 		bids, asks := e.book.Snapshot(20)
 		e.publish(e.marketID, "book_snapshot", map[string]any{"bids": bids, "asks": asks})
-		for _, t := range trades {
-			e.publish(e.marketID, "trade", t)
-		}
+		e.publish(e.marketID, "order_expired", map[string]any{"order_id": orderID})
 	}
-
-	return model.PlaceOrderResult{OrderID: orderID, Status: status, Trades: trades}
 }
 
 // ── Cancel ───────────────────────────────────────────
 
 func (e *MarketEngine) cancelOrder(orderID, userID string) error {
+	if e.suspended {
+		return fmt.Errorf("market suspended")
+	}
+	if e.matchingMode == model.ModeEpoch && !e.epochCutoffAt.IsZero() && time.Now().After(e.epochCutoffAt) {
+		return fmt.Errorf("cancels are closed for the last %s of this epoch", epochCancelCutoff)
+	}
+
 	ctx := context.Background()
 	o, err := e.store.GetOrder(ctx, orderID)
 	if err != nil || o == nil {
@@ -464,15 +2109,14 @@ func (e *MarketEngine) cancelOrder(orderID, userID string) error {
 	}
 	defer tx.Rollback()
 
-	_, err = tx.Exec(`UPDATE orders SET status='CANCELED', remaining_qty=0, locked_cents=0, updated_at=now() WHERE id=$1`, orderID)
-	if err != nil {
+	if _, err := e.store.CancelOrderTx(tx, orderID); err != nil {
 		return err
 	}
-	if err := db.WalletAddLocked(tx, userID, -o.LockedCents); err != nil {
+	if err := e.store.WalletAddLocked(tx, userID, -o.LockedCents); err != nil {
 		return err
 	}
 	seq := e.nextSeq()
-	db.AppendEvent(tx, &e.marketID, &seq, "OrderCanceled", map[string]any{
+	e.store.AppendEvent(tx, &e.marketID, &seq, "OrderCanceled", map[string]any{
 		"order_id": orderID, "user_id": userID,
 	})
 	if err := tx.Commit(); err != nil {
@@ -488,33 +2132,33 @@ func (e *MarketEngine) cancelOrder(orderID, userID string) error {
 
 // ── Settlement ───────────────────────────────────────
 
-func (e *MarketEngine) resolveMarket(resolvesTo, adminID string) error {
+// resolveMarketInTx performs the DB-level settlement for this market —
+// paying out or releasing locks per position, marking the market
+// resolved, and publishing the resolution event — using the
+// caller-supplied tx instead of beginning and committing its own. This
+// lets resolveMarket share one tx across an entire hedge group (see
+// Manager.autoResolveSiblings) so the group's settlement resolves, or
+// rolls back, as a single atomic unit. Open orders are canceled first,
+// each in its own committed tx, so a rollback of tx does not restore them.
+func (e *MarketEngine) resolveMarketInTx(tx store.Tx, resolvesTo, adminID string) (totalPayout int64, settled int, err error) {
 	ctx := context.Background()
 
-	// Cancel all open orders first
+	// Cancel all open orders first. Each cancel commits its own tx
+	// (cancelOrderInternal), same as a standalone order cancel; only the
+	// payout/lock-release settlement below shares tx with the rest of the
+	// hedge group.
 	openOrders, err := e.store.GetOpenOrders(ctx, e.marketID)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 	for _, o := range openOrders {
-		// Use internal cancel (already in engine goroutine)
-		e.cancelOrderInternal(o.ID, o.UserID)
+		e.cancelOrderInternal(o.ID, o.UserID, o.LockedCents)
 	}
 
-	// Get all positions
 	positions, err := e.store.ListPositions(ctx, e.marketID)
 	if err != nil {
-		return err
-	}
-
-	tx, err := e.store.BeginTx(ctx)
-	if err != nil {
-		return err
+		return 0, 0, err
 	}
-	defer tx.Rollback()
-
-	totalPayout := int64(0)
-	settled := 0
 
 	for _, pos := range positions {
 		if pos.YesShares == 0 {
@@ -536,13 +2180,13 @@ func (e *MarketEngine) resolveMarket(resolvesTo, adminID string) error {
 		}
 
 		if payout != 0 {
-			if err := db.WalletAddBalance(tx, pos.UserID, payout); err != nil {
-				return err
+			if err := e.store.WalletAddBalance(tx, pos.UserID, payout); err != nil {
+				return 0, 0, err
 			}
 		}
 		if lockRelease > 0 {
-			if err := db.WalletAddLocked(tx, pos.UserID, -lockRelease); err != nil {
-				return err
+			if err := e.store.WalletAddLocked(tx, pos.UserID, -lockRelease); err != nil {
+				return 0, 0, err
 			}
 		}
 		if payout > 0 {
@@ -551,15 +2195,39 @@ func (e *MarketEngine) resolveMarket(resolvesTo, adminID string) error {
 		settled++
 	}
 
-	if err := db.ResolveMarket(tx, e.marketID, resolvesTo); err != nil {
-		return err
+	if err := e.store.ResolveMarket(tx, e.marketID, resolvesTo); err != nil {
+		return 0, 0, err
 	}
 
-	db.AppendEvent(tx, &e.marketID, nil, "MarketResolved", map[string]any{
-		"resolves_to": resolvesTo, "admin_id": adminID,
-		"settled_positions": settled, "total_payout": totalPayout,
+	e.store.PublishEvent(tx, &e.marketID, model.TopicMarketResolved, model.MarketResolvedPayload{
+		ResolvesTo: resolvesTo, AdminID: adminID,
+		SettledPositions: settled, TotalPayout: totalPayout,
 	})
 
+	return totalPayout, settled, nil
+}
+
+func (e *MarketEngine) resolveMarket(resolvesTo, adminID string) error {
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	totalPayout, settled, err := e.resolveMarketInTx(tx, resolvesTo, adminID)
+	if err != nil {
+		return err
+	}
+
+	// Auto-resolve hedge group siblings within this same tx so payouts and
+	// lock releases across the whole group commit, or roll back, together.
+	if e.resolveSiblingsInTx != nil {
+		if err := e.resolveSiblingsInTx(tx, e.marketID, resolvesTo, adminID); err != nil {
+			return err
+		}
+	}
+
 	if err := tx.Commit(); err != nil {
 		return err
 	}
@@ -568,17 +2236,238 @@ func (e *MarketEngine) resolveMarket(resolvesTo, adminID string) error {
 	return nil
 }
 
-func (e *MarketEngine) cancelOrderInternal(orderID, userID string) {
+// updateInstrument persists admin-edited instrument metadata and swaps it
+// into the live engine, runs on the engine goroutine like every other
+// mutation so it can never race with an in-flight processOrder.
+func (e *MarketEngine) updateInstrument(instrument model.Instrument, adminID string) error {
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := e.store.UpdateMarketInstrument(tx, e.marketID, instrument); err != nil {
+		return err
+	}
+	e.store.AppendEvent(tx, &e.marketID, nil, "InstrumentUpdated", map[string]any{
+		"admin_id": adminID, "instrument": instrument,
+	})
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	e.instrument = instrument
+	return nil
+}
+
+// ── Suspension ───────────────────────────────────────
+
+// suspendMarket suspends the market, either immediately or by persisting a
+// schedule for suspendAt to take effect later.
+func (e *MarketEngine) suspendMarket(purge bool, suspendAt *time.Time) error {
+	ctx := context.Background()
+	if suspendAt != nil && suspendAt.After(time.Now()) {
+		tx, err := e.store.BeginTx(ctx)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := e.store.ScheduleMarketSuspension(tx, e.marketID, *suspendAt, purge); err != nil {
+			return err
+		}
+		seq := e.nextSeq()
+		e.store.AppendEvent(tx, &e.marketID, &seq, "MarketSuspendScheduled", map[string]any{
+			"suspend_at": *suspendAt, "purge": purge,
+		})
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+
+		e.scheduleSuspensionTimer(purge, *suspendAt)
+		if e.publish != nil {
+			e.publish(e.marketID, "market_suspend_scheduled", map[string]any{"suspend_at": *suspendAt, "purge": purge})
+		}
+		return nil
+	}
+
+	return e.applySuspension(purge)
+}
+
+// scheduleSuspensionTimer arranges for a suspendTickCmd to fire once at
+// arrives, the same way scheduleExpiry arranges GTT cancellation and
+// startEpoch arranges the next epoch tick. Bumping suspendGen here
+// invalidates any suspension timer scheduled before this one.
+func (e *MarketEngine) scheduleSuspensionTimer(purge bool, at time.Time) {
+	e.suspendGen++
+	gen := e.suspendGen
+	d := time.Until(at)
+	if d < 0 {
+		d = 0
+	}
+	time.AfterFunc(d, func() {
+		e.cmdCh <- suspendTickCmd{gen: gen, purge: purge}
+	})
+}
+
+// snapshotInterval and snapshotEveryTrades bound how much history a boot
+// ever needs to replay: saveSnapshot runs at least this often, and also
+// fires early once this many trades have landed since the last one.
+const (
+	snapshotInterval    = 30 * time.Second
+	snapshotEveryTrades = 500
+)
+
+// scheduleSnapshotTimer arranges for a snapshotTickCmd to fire once after
+// snapshotInterval, the same way scheduleSuspensionTimer arranges a
+// suspension. Unlike suspension, this isn't guarded by a generation
+// counter: the engine runs for the process's lifetime, so there's no
+// "stale" timer to discard.
+func (e *MarketEngine) scheduleSnapshotTimer() {
+	time.AfterFunc(snapshotInterval, func() {
+		e.cmdCh <- snapshotTickCmd{}
+	})
+}
+
+// saveSnapshot serializes the current book, positions, and platform fee
+// and writes them to market_snapshots tagged with the engine's current
+// seq, so a future boot can load this snapshot and only replay
+// orders/trades/events with seq greater than it. Writes synchronously on
+// the engine goroutine the same way closeKline persists a completed bar —
+// a quick local write, not worth a separate goroutine for.
+func (e *MarketEngine) saveSnapshot() {
+	ctx := context.Background()
+	bookJSON, err := e.book.SnapshotBytes()
+	if err != nil {
+		log.Printf("[engine] market %s: snapshot book marshal failed: %v", e.marketID, err)
+		return
+	}
+	positions, err := e.store.ListPositions(ctx, e.marketID)
+	if err != nil {
+		log.Printf("[engine] market %s: snapshot positions load failed: %v", e.marketID, err)
+		return
+	}
+	positionsJSON, err := json.Marshal(positions)
+	if err != nil {
+		log.Printf("[engine] market %s: snapshot positions marshal failed: %v", e.marketID, err)
+		return
+	}
+	platformFee, err := e.store.GetPlatformFee(ctx)
+	if err != nil {
+		log.Printf("[engine] market %s: snapshot platform fee load failed: %v", e.marketID, err)
+		return
+	}
+
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		log.Printf("[engine] market %s: snapshot tx begin failed: %v", e.marketID, err)
+		return
+	}
+	defer tx.Rollback()
+	if err := e.store.SaveSnapshot(tx, e.marketID, e.seq, bookJSON, positionsJSON, platformFee); err != nil {
+		log.Printf("[engine] market %s: snapshot save failed: %v", e.marketID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("[engine] market %s: snapshot commit failed: %v", e.marketID, err)
+		return
+	}
+	e.tradesSinceSnapshot = 0
+}
+
+// applySuspension takes a scheduled or immediate suspension into effect:
+// it flips the engine into a rejecting state and, if purge is true,
+// cancels every resting order the same way resolveMarket does before
+// settling a market.
+func (e *MarketEngine) applySuspension(purge bool) error {
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := e.store.SuspendMarketNow(tx, e.marketID); err != nil {
+		return err
+	}
+	e.store.PublishEvent(tx, &e.marketID, model.TopicMarketSuspended, model.MarketSuspendedPayload{Purge: purge})
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	e.suspended = true
+	e.suspendGen++
+
+	if purge {
+		openOrders, err := e.store.GetOpenOrders(ctx, e.marketID)
+		if err != nil {
+			log.Printf("[engine] market %s: suspend purge failed to list open orders: %v", e.marketID, err)
+		} else {
+			for _, o := range openOrders {
+				e.cancelOrderInternal(o.ID, o.UserID, o.LockedCents)
+			}
+		}
+	}
+
+	if e.publish != nil {
+		bids, asks := e.book.Snapshot(20)
+		e.publish(e.marketID, "book_snapshot", map[string]any{"bids": bids, "asks": asks})
+	}
+	return nil
+}
+
+// resumeMarket re-enables order placement and cancellation. Bumping
+// suspendGen invalidates any scheduled suspension timer still pending.
+func (e *MarketEngine) resumeMarket() error {
+	ctx := context.Background()
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := e.store.ResumeMarket(tx, e.marketID); err != nil {
+		return err
+	}
+	seq := e.nextSeq()
+	e.store.AppendEvent(tx, &e.marketID, &seq, "MarketResumed", nil)
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	e.suspended = false
+	e.suspendGen++
+
+	if e.publish != nil {
+		bids, asks := e.book.Snapshot(20)
+		e.publish(e.marketID, "book_snapshot", map[string]any{"bids": bids, "asks": asks})
+		e.publish(e.marketID, "market_resumed", map[string]any{"market_id": e.marketID})
+	}
+	return nil
+}
+
+// cancelOrderInternal cancels a resting order on behalf of the engine
+// itself (settlement, suspension purge) rather than a user request.
+// lockedCents must be the order's locked_cents as last read by the
+// caller: reading it back from the row after the UPDATE below would
+// always come back 0, since that same UPDATE is what zeroes it — the
+// same bug store.CancelOrderTx had. cancelOrder and expireOrder already
+// capture their order's LockedCents before canceling for this reason;
+// this does the same.
+func (e *MarketEngine) cancelOrderInternal(orderID, userID string, lockedCents int64) {
 	e.book.Remove(orderID)
 	ctx := context.Background()
-	tx, _ := e.store.BeginTx(ctx)
-	if tx == nil {
+	tx, err := e.store.BeginTx(ctx)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+	if _, err := e.store.CancelOrderTx(tx, orderID); err != nil {
+		return
+	}
+	if err := e.store.WalletAddLocked(tx, userID, -lockedCents); err != nil {
 		return
 	}
-	tx.Exec(`UPDATE orders SET status='CANCELED', remaining_qty=0, locked_cents=0, updated_at=now() WHERE id=$1`, orderID)
-	// Get the locked amount from DB
-	var locked int64
-	tx.QueryRow(`SELECT locked_cents FROM orders WHERE id=$1`, orderID).Scan(&locked)
-	db.WalletAddLocked(tx, userID, -locked)
 	tx.Commit()
 }
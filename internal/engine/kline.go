@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"context"
+	"time"
+
+	"wager-exchange/internal/model"
+)
+
+// klineIntervals lists every bucket width the engine aggregates trades into.
+var klineIntervals = map[string]time.Duration{
+	"1m":  time.Minute,
+	"5m":  5 * time.Minute,
+	"15m": 15 * time.Minute,
+	"1h":  time.Hour,
+	"4h":  4 * time.Hour,
+	"1d":  24 * time.Hour,
+}
+
+func bucketStart(ts time.Time, interval string) time.Time {
+	d := klineIntervals[interval]
+	return ts.Truncate(d)
+}
+
+// recordTrade folds a fill into every interval's in-progress bar. When a
+// trade lands in a new bucket, the previous bar is persisted and the WS
+// kline channel is notified that it closed.
+func (e *MarketEngine) recordTrade(priceCents, qty int, ts time.Time) {
+	for interval, dur := range klineIntervals {
+		bucket := bucketStart(ts, interval)
+		bar := e.klines[interval]
+		if bar == nil || !bar.OpenTime.Equal(bucket) {
+			if bar != nil {
+				e.closeKline(interval, *bar)
+			}
+			bar = &model.Kline{
+				MarketID: e.marketID, Interval: interval,
+				OpenTime: bucket, CloseTime: bucket.Add(dur),
+				Open: priceCents, High: priceCents, Low: priceCents, Close: priceCents,
+				Volume: qty, TradeCount: 1,
+			}
+			e.klines[interval] = bar
+		} else {
+			if priceCents > bar.High {
+				bar.High = priceCents
+			}
+			if priceCents < bar.Low {
+				bar.Low = priceCents
+			}
+			bar.Close = priceCents
+			bar.Volume += qty
+			bar.TradeCount++
+		}
+		if e.publish != nil {
+			e.publish(e.marketID, "kline", *bar)
+		}
+	}
+
+	e.tradesSinceSnapshot++
+	if e.tradesSinceSnapshot >= snapshotEveryTrades {
+		e.saveSnapshot()
+	}
+}
+
+// closeKline persists a completed bar and announces it as closed so
+// clients know to stop merging it with REST history.
+func (e *MarketEngine) closeKline(interval string, bar model.Kline) {
+	bar.Closed = true
+	if tx, err := e.store.BeginTx(context.Background()); err == nil {
+		if err := e.store.UpsertKline(tx, &bar); err == nil {
+			tx.Commit()
+		} else {
+			tx.Rollback()
+		}
+	}
+	if e.publish != nil {
+		e.publish(e.marketID, "kline", bar)
+	}
+}
+
+// CurrentKline returns the in-progress bar for an interval, if any, so the
+// REST endpoint can merge it with persisted history.
+func (e *MarketEngine) CurrentKline(interval string) (model.Kline, bool) {
+	bar := e.klines[interval]
+	if bar == nil {
+		return model.Kline{}, false
+	}
+	return *bar, true
+}
+
+// seedKlines replays recent trades on boot so the in-progress bar reflects
+// reality immediately instead of starting empty mid-bucket.
+func (e *MarketEngine) seedKlines(ctx context.Context) error {
+	trades, err := e.store.ListTrades(ctx, e.marketID, 500)
+	if err != nil {
+		return err
+	}
+	// ListTrades returns newest-first; replay oldest-first to build bars
+	// in chronological order without publishing, since there are no
+	// subscribers yet at boot.
+	for i := len(trades) - 1; i >= 0; i-- {
+		t := trades[i]
+		for interval, dur := range klineIntervals {
+			bucket := bucketStart(t.CreatedAt, interval)
+			bar := e.klines[interval]
+			if bar == nil || !bar.OpenTime.Equal(bucket) {
+				bar = &model.Kline{
+					MarketID: e.marketID, Interval: interval,
+					OpenTime: bucket, CloseTime: bucket.Add(dur),
+					Open: t.PriceCents, High: t.PriceCents, Low: t.PriceCents, Close: t.PriceCents,
+					Volume: t.Qty, TradeCount: 1,
+				}
+				e.klines[interval] = bar
+			} else {
+				if t.PriceCents > bar.High {
+					bar.High = t.PriceCents
+				}
+				if t.PriceCents < bar.Low {
+					bar.Low = t.PriceCents
+				}
+				bar.Close = t.PriceCents
+				bar.Volume += t.Qty
+				bar.TradeCount++
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package engine
+
+import (
+	"context"
+	"testing"
+
+	"wager-exchange/internal/model"
+	"wager-exchange/internal/store/memory"
+)
+
+// fundUser creates userID's wallet and gives it a starting balance, using
+// the same tx-based path production code goes through rather than poking
+// memory.Store's fields directly.
+func fundUser(t *testing.T, st *memory.Store, userID string, balanceCents int64) {
+	t.Helper()
+	ctx := context.Background()
+	if err := st.CreateWallet(ctx, userID); err != nil {
+		t.Fatalf("create wallet: %v", err)
+	}
+	tx, err := st.BeginTx(ctx)
+	if err != nil {
+		t.Fatalf("begin tx: %v", err)
+	}
+	if err := st.WalletAddBalance(tx, userID, balanceCents); err != nil {
+		t.Fatalf("fund wallet: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+}
+
+// newTestEngine builds a MarketEngine against a fresh memory.Store instead
+// of Postgres, so placing and matching orders can be tested hermetically
+// and fast.
+func newTestEngine(t *testing.T, marketID string) (*MarketEngine, *memory.Store) {
+	t.Helper()
+	st := memory.New()
+	noSiblings := func(string) []string { return nil }
+	defaultKind := func(string) HedgeKind { return HedgeMutuallyExclusive }
+	eng, err := newMarketEngine(context.Background(), marketID, st, nil, 0, noSiblings, defaultKind, nil, nil)
+	if err != nil {
+		t.Fatalf("newMarketEngine: %v", err)
+	}
+	go eng.run(context.Background())
+	return eng, st
+}
+
+func TestEngineWithMemoryStorePlacesAndMatchesOrders(t *testing.T) {
+	eng, st := newTestEngine(t, "mkt-1")
+	fundUser(t, st, "seller", 10000)
+	fundUser(t, st, "buyer", 10000)
+
+	sell := eng.PlaceOrder("seller", model.PlaceOrderReq{
+		Side: model.SideSell, Type: model.TypeLimit, PriceCents: intPtr(60), Qty: 5,
+	})
+	if sell.Status != model.StatusOpen {
+		t.Fatalf("expected resting sell to be OPEN, got %s (%s)", sell.Status, sell.Reason)
+	}
+
+	buy := eng.PlaceOrder("buyer", model.PlaceOrderReq{
+		Side: model.SideBuy, Type: model.TypeLimit, PriceCents: intPtr(60), Qty: 5,
+	})
+	if buy.Status != model.StatusFilled {
+		t.Fatalf("expected crossing buy to be FILLED, got %s (%s)", buy.Status, buy.Reason)
+	}
+	if len(buy.Trades) != 1 || buy.Trades[0].Qty != 5 {
+		t.Fatalf("expected one 5-qty trade, got %v", buy.Trades)
+	}
+	if eng.book.Size() != 0 {
+		t.Fatalf("expected empty book after full match, got size %d", eng.book.Size())
+	}
+}
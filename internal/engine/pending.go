@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"container/list"
+	"time"
+)
+
+const (
+	pendingUpdateCapacity = 1024
+	pendingUpdateTTL      = 5 * time.Minute
+)
+
+// pendingUpdateKind distinguishes a stashed fill from a stashed cancel.
+type pendingUpdateKind int
+
+const (
+	pendingFill pendingUpdateKind = iota
+	pendingCancel
+)
+
+// pendingUpdate is a fill or cancel that arrived (via ApplyFill/Remove)
+// for an OrderID the book doesn't know about yet, because the Add for it
+// is still in flight — a real risk once fills/cancels are delivered
+// asynchronously (e.g. over a WebSocket) rather than strictly serialized
+// with Add. It is reconciled against the order's eventual Add instead of
+// being silently dropped.
+type pendingUpdate struct {
+	kind      pendingUpdateKind
+	fillQty   int // cumulative qty filled so far, when kind == pendingFill
+	updatedAt time.Time
+}
+
+// pendingUpdateCache is a small LRU of pendingUpdate keyed by OrderID,
+// bounded by both capacity and a TTL so a burst of updates for orders
+// that never arrive (a cancel racing a rejected placement, say) can't
+// grow unbounded.
+type pendingUpdateCache struct {
+	capacity int
+	ttl      time.Duration
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type pendingCacheEntry struct {
+	orderID string
+	update  pendingUpdate
+}
+
+func newPendingUpdateCache(capacity int, ttl time.Duration) *pendingUpdateCache {
+	return &pendingUpdateCache{
+		capacity: capacity,
+		ttl:      ttl,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+// stashFill records a fill for an order not yet on the book, merging
+// with any existing pending fill so cumulative qty survives multiple
+// out-of-order fills arriving before the Add. A pending cancel is left
+// untouched — once canceled, later fills for the same order are moot.
+func (c *pendingUpdateCache) stashFill(orderID string, fillQty int, now time.Time) {
+	if el, ok := c.items[orderID]; ok {
+		entry := el.Value.(*pendingCacheEntry)
+		if entry.update.kind == pendingCancel {
+			c.ll.MoveToFront(el)
+			return
+		}
+		entry.update.fillQty += fillQty
+		entry.update.updatedAt = now
+		c.ll.MoveToFront(el)
+		return
+	}
+	c.put(orderID, pendingUpdate{kind: pendingFill, fillQty: fillQty, updatedAt: now})
+}
+
+// stashCancel records a cancel for an order not yet on the book. It
+// always overrides a pending fill: a cancel is terminal.
+func (c *pendingUpdateCache) stashCancel(orderID string, now time.Time) {
+	c.put(orderID, pendingUpdate{kind: pendingCancel, updatedAt: now})
+}
+
+func (c *pendingUpdateCache) put(orderID string, u pendingUpdate) {
+	if el, ok := c.items[orderID]; ok {
+		el.Value.(*pendingCacheEntry).update = u
+		c.ll.MoveToFront(el)
+		return
+	}
+	el := c.ll.PushFront(&pendingCacheEntry{orderID: orderID, update: u})
+	c.items[orderID] = el
+	if c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*pendingCacheEntry).orderID)
+		}
+	}
+}
+
+// take returns and evicts the pending update for orderID, if any. An
+// entry past its TTL is discarded and reported as absent.
+func (c *pendingUpdateCache) take(orderID string, now time.Time) (pendingUpdate, bool) {
+	el, ok := c.items[orderID]
+	if !ok {
+		return pendingUpdate{}, false
+	}
+	c.ll.Remove(el)
+	delete(c.items, orderID)
+	entry := el.Value.(*pendingCacheEntry)
+	if now.Sub(entry.update.updatedAt) > c.ttl {
+		return pendingUpdate{}, false
+	}
+	return entry.update, true
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"wager-exchange/internal/model"
+)
+
+// bookSnapshotEntry is the JSON shape of one resting order, used both by
+// Snapshot/LoadSnapshot and by the ORDER_ADD payload in the event log.
+// It mirrors OrderEntry's exported fields; the intrusive list pointers
+// are never serialized since Add rebuilds them.
+type bookSnapshotEntry struct {
+	OrderID      string `json:"order_id"`
+	UserID       string `json:"user_id"`
+	Side         string `json:"side"`
+	PriceCents   int    `json:"price_cents"`
+	RemainingQty int    `json:"remaining_qty"`
+	LockedCents  int64  `json:"locked_cents"`
+	Seq          int64  `json:"seq"`
+
+	// Iceberg fields; zero for a plain order. DisplayMax is the clip
+	// size refreshes replenish up to, not exported on OrderEntry itself.
+	DisplayQty int `json:"display_qty,omitempty"`
+	TotalQty   int `json:"total_qty,omitempty"`
+	DisplayMax int `json:"display_max,omitempty"`
+}
+
+func toSnapshotEntry(e *OrderEntry) bookSnapshotEntry {
+	return bookSnapshotEntry{
+		OrderID:      e.OrderID,
+		UserID:       e.UserID,
+		Side:         e.Side,
+		PriceCents:   e.PriceCents,
+		RemainingQty: e.RemainingQty,
+		LockedCents:  e.LockedCents,
+		Seq:          e.Seq,
+		DisplayQty:   e.DisplayQty,
+		TotalQty:     e.TotalQty,
+		DisplayMax:   e.displayMax,
+	}
+}
+
+func fromSnapshotEntry(se bookSnapshotEntry) *OrderEntry {
+	return &OrderEntry{
+		OrderID:      se.OrderID,
+		UserID:       se.UserID,
+		Side:         se.Side,
+		PriceCents:   se.PriceCents,
+		RemainingQty: se.RemainingQty,
+		LockedCents:  se.LockedCents,
+		Seq:          se.Seq,
+		DisplayQty:   se.DisplayQty,
+		TotalQty:     se.TotalQty,
+		displayMax:   se.DisplayMax,
+	}
+}
+
+// Events drains and returns every Add/Remove/ApplyFill recorded since the
+// book was created or last drained, in Seq order. The caller (typically
+// the owning MarketEngine, on some periodic or per-command cadence) is
+// responsible for persisting these, e.g. via db.AppendEvent per entry;
+// OrderBook itself has no DB dependency.
+func (b *OrderBook) Events() []model.EventLog {
+	out := b.eventLog
+	b.eventLog = nil
+	return out
+}
+
+// SnapshotBytes serializes every resting order to JSON via toSnapshotEntry,
+// preserving iceberg orders' unexported displayMax. Taken periodically, it
+// bounds how much of the event log needs to be replayed on restart: once a
+// snapshot is durably persisted, every event logged before it was taken can
+// be discarded. Not to be confused with (*OrderBook).Snapshot(depth), which
+// returns priced book levels for display rather than a restorable encoding.
+func (b *OrderBook) SnapshotBytes() ([]byte, error) {
+	entries := make([]bookSnapshotEntry, 0, b.Size())
+	for _, e := range b.AllBids() {
+		entries = append(entries, toSnapshotEntry(e))
+	}
+	for _, e := range b.AllAsks() {
+		entries = append(entries, toSnapshotEntry(e))
+	}
+	return json.Marshal(entries)
+}
+
+// LoadSnapshot replaces the book's contents with the orders encoded in
+// data (as produced by SnapshotBytes). It is meant to run against a freshly
+// constructed, empty OrderBook before any events are replayed on top of
+// it; loading a snapshot is not itself logged.
+func (b *OrderBook) LoadSnapshot(data []byte) error {
+	var entries []bookSnapshotEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return err
+	}
+	b.bids = newPriceSkipList()
+	b.asks = newPriceSkipList()
+	b.index = make(map[string]*OrderEntry)
+	b.eventLog = nil
+	b.logSeq = 0
+	for _, se := range entries {
+		b.Add(fromSnapshotEntry(se))
+	}
+	b.eventLog = nil
+	b.logSeq = 0
+	return nil
+}
+
+// Replay reconstructs an OrderBook from a persisted event stream —
+// everything logged via Events — starting from an empty book and applying
+// events in Seq order so the result is byte-identical to the book that
+// produced them. It does not start from a snapshot: the stream has to
+// cover the book's whole history. This is what gives crash recovery
+// (replay the saved log) and deterministic backtesting (replay a saved
+// stream to regenerate the exact same matches).
+func Replay(events []model.EventLog) (*OrderBook, error) {
+	sorted := make([]model.EventLog, len(events))
+	copy(sorted, events)
+	sort.Slice(sorted, func(i, j int) bool { return seqOf(sorted[i]) < seqOf(sorted[j]) })
+
+	b := NewOrderBook()
+	for _, ev := range sorted {
+		raw, err := json.Marshal(ev.PayloadJSON)
+		if err != nil {
+			return nil, fmt.Errorf("replay: marshal payload for %s: %w", ev.Type, err)
+		}
+		switch ev.Type {
+		case model.EventOrderAdd:
+			var se bookSnapshotEntry
+			if err := json.Unmarshal(raw, &se); err != nil {
+				return nil, fmt.Errorf("replay: decode %s: %w", ev.Type, err)
+			}
+			b.Add(fromSnapshotEntry(se))
+		case model.EventOrderRemove:
+			var p struct {
+				OrderID string `json:"order_id"`
+			}
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, fmt.Errorf("replay: decode %s: %w", ev.Type, err)
+			}
+			b.Remove(p.OrderID)
+		case model.EventOrderFill:
+			var p struct {
+				OrderID string `json:"order_id"`
+				FillQty int    `json:"fill_qty"`
+			}
+			if err := json.Unmarshal(raw, &p); err != nil {
+				return nil, fmt.Errorf("replay: decode %s: %w", ev.Type, err)
+			}
+			b.ApplyFill(p.OrderID, p.FillQty)
+		default:
+			return nil, fmt.Errorf("replay: unknown event type %q", ev.Type)
+		}
+	}
+	// The replayed mutations re-populated b.eventLog along the way;
+	// clear it so the returned book starts clean for further live Events.
+	b.eventLog = nil
+	b.logSeq = 0
+	return b, nil
+}
+
+func seqOf(ev model.EventLog) int64 {
+	if ev.Seq == nil {
+		return 0
+	}
+	return *ev.Seq
+}
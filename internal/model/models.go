@@ -14,8 +14,23 @@ const (
 type MarketStatus string
 
 const (
-	MarketOpen     MarketStatus = "OPEN"
-	MarketResolved MarketStatus = "RESOLVED"
+	MarketOpen      MarketStatus = "OPEN"
+	MarketSuspended MarketStatus = "SUSPENDED"
+	MarketResolved  MarketStatus = "RESOLVED"
+)
+
+// MatchingMode selects how a market turns resting interest into trades.
+type MatchingMode string
+
+const (
+	// ModeContinuous matches incoming orders against the book immediately
+	// (FIFO price-time priority). This is the default and, until EPOCH
+	// matching existed, the only mode.
+	ModeContinuous MatchingMode = "CONTINUOUS"
+	// ModeEpoch defers matching: orders rest on the book untouched until a
+	// fixed-duration epoch elapses, at which point a single sealed-bid
+	// uniform-price auction clears the whole book at once.
+	ModeEpoch MatchingMode = "EPOCH"
 )
 
 type OrderSide string
@@ -42,6 +57,26 @@ const (
 	StatusRejected OrderStatus = "REJECTED"
 )
 
+type TimeInForce string
+
+const (
+	TIFGTC TimeInForce = "GTC" // good-till-canceled (default)
+	TIFIOC TimeInForce = "IOC" // immediate-or-cancel
+	TIFFOK TimeInForce = "FOK" // fill-or-kill
+	TIFGTT TimeInForce = "GTT" // good-till-time
+)
+
+// SelfTradePrevention controls what happens when a taker would match
+// against a resting order owned by the same user.
+type SelfTradePrevention string
+
+const (
+	STPNone        SelfTradePrevention = ""
+	STPCancelTaker SelfTradePrevention = "CANCEL_TAKER"
+	STPCancelMaker SelfTradePrevention = "CANCEL_MAKER"
+	STPCancelBoth  SelfTradePrevention = "CANCEL_BOTH"
+)
+
 // ── Domain Objects ───────────────────────────────────
 
 type User struct {
@@ -70,6 +105,45 @@ type Market struct {
 	TickSizeCents int          `json:"tick_size_cents"`
 	CreatedAt     time.Time    `json:"created_at"`
 	ResolvedAt    *time.Time   `json:"resolved_at,omitempty"`
+	Instrument    Instrument   `json:"instrument"`
+	// MatchingMode and EpochDurationMs are fixed at market creation and
+	// are not changed for the lifetime of the market's engine.
+	MatchingMode    MatchingMode `json:"matching_mode"`
+	EpochDurationMs int          `json:"epoch_duration_ms,omitempty"`
+	// SuspendAt and SuspendPurge hold a pending scheduled suspension, so it
+	// survives a restart before it takes effect; both are cleared once the
+	// suspension takes effect or the market is resumed.
+	SuspendAt    *time.Time `json:"suspend_at,omitempty"`
+	SuspendPurge bool       `json:"suspend_purge,omitempty"`
+}
+
+// Instrument is per-market instrument metadata and order-placement limits,
+// analogous to the tick-size/lot-size metadata exchange SDKs publish.
+type Instrument struct {
+	PriceTickCents       int   `json:"price_tick_cents"`
+	QtyLotSize           int   `json:"qty_lot_size"`
+	MinQty               int   `json:"min_qty"`
+	MaxQty               int   `json:"max_qty"`
+	MinNotionalCents     int64 `json:"min_notional_cents"`
+	MaxNotionalCents     int64 `json:"max_notional_cents"`
+	PriceBandBps         int   `json:"price_band_bps"` // max distance from last trade for new limit orders
+	MaxOpenOrdersPerUser int   `json:"max_open_orders_per_user"`
+}
+
+// DefaultInstrument matches the limits the engine enforced before
+// per-market instrument metadata existed (1-99 price, qty>=1); the caps it
+// adds (max qty, max notional, open orders per user) are set high, not off.
+func DefaultInstrument() Instrument {
+	return Instrument{
+		PriceTickCents:       1,
+		QtyLotSize:           1,
+		MinQty:               1,
+		MaxQty:               1_000_000,
+		MinNotionalCents:     1,
+		MaxNotionalCents:     1_000_000_000,
+		PriceBandBps:         980_000, // 1c to 99c, the widest possible move, i.e. unconstrained by default
+		MaxOpenOrdersPerUser: 1_000,
+	}
 }
 
 type Order struct {
@@ -85,6 +159,9 @@ type Order struct {
 	Status        OrderStatus `json:"status"`
 	Seq           int64       `json:"seq"`
 	ClientOrderID *string     `json:"client_order_id,omitempty"`
+	TimeInForce   TimeInForce `json:"time_in_force"`
+	PostOnly      bool        `json:"post_only"`
+	ExpiresAt     *time.Time  `json:"expires_at,omitempty"`
 	CreatedAt     time.Time   `json:"created_at"`
 	UpdatedAt     time.Time   `json:"updated_at"`
 }
@@ -121,6 +198,142 @@ type EventLog struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// Event types for the OrderBook's own replay log (engine.OrderBook.Events
+// / engine.Replay), distinct from the free-form event types the market
+// engine logs via db.AppendEvent (e.g. "TradeExecuted"). These three are
+// the only mutations that change book state, so they're sufficient to
+// reconstruct a book byte-identically from a recorded stream.
+const (
+	EventOrderAdd    = "ORDER_ADD"
+	EventOrderRemove = "ORDER_REMOVE"
+	EventOrderFill   = "ORDER_FILL"
+)
+
+// FundingStatus tracks an off-platform funds movement (deposit or
+// withdrawal) through its lifecycle. Deposits and withdrawals share the
+// same status set since both settle through the same external-provider
+// confirmation flow.
+type FundingStatus string
+
+const (
+	FundingPending   FundingStatus = "PENDING"
+	FundingConfirmed FundingStatus = "CONFIRMED"
+	FundingFailed    FundingStatus = "FAILED"
+	FundingCanceled  FundingStatus = "CANCELED"
+)
+
+// Deposit is an inbound off-platform funds movement. ExternalTxnID
+// together with Provider is unique, so a webhook replayed by the
+// provider can be matched back to the same row instead of double-crediting.
+type Deposit struct {
+	ID            string        `json:"id"`
+	UserID        string        `json:"user_id"`
+	Asset         string        `json:"asset"`
+	AmountCents   int64         `json:"amount_cents"`
+	ExternalTxnID string        `json:"external_txn_id"`
+	Provider      string        `json:"provider"`
+	Status        FundingStatus `json:"status"`
+	FeeCents      int64         `json:"fee_cents"`
+	CreatedAt     time.Time     `json:"created_at"`
+	ConfirmedAt   *time.Time    `json:"confirmed_at,omitempty"`
+}
+
+// Withdrawal is an outbound off-platform funds movement. ExternalTxnID is
+// unset until the provider accepts the payout and hands back a reference
+// to track it by.
+type Withdrawal struct {
+	ID            string        `json:"id"`
+	UserID        string        `json:"user_id"`
+	Asset         string        `json:"asset"`
+	AmountCents   int64         `json:"amount_cents"`
+	ExternalTxnID *string       `json:"external_txn_id,omitempty"`
+	Provider      string        `json:"provider"`
+	Status        FundingStatus `json:"status"`
+	FeeCents      int64         `json:"fee_cents"`
+	CreatedAt     time.Time     `json:"created_at"`
+	ConfirmedAt   *time.Time    `json:"confirmed_at,omitempty"`
+}
+
+// Topic identifies the kind of a durable outbox event, modeled after
+// dcrdex's Topic refactor: each one has a fixed, strongly-typed payload
+// struct below instead of the free-form `type string` + `payload any`
+// pairs db.AppendEvent still accepts. Only the events a WS subscriber or
+// webhook actually needs to filter on have been given a Topic so far;
+// the rest continue to flow through db.AppendEvent's untyped log.
+type Topic string
+
+const (
+	TopicOrderPlaced         Topic = "ORDER_PLACED"
+	TopicOrderFilled         Topic = "ORDER_FILLED"
+	TopicMarketSuspended     Topic = "MARKET_SUSPENDED"
+	TopicMarketResolved      Topic = "MARKET_RESOLVED"
+	TopicDepositConfirmed    Topic = "DEPOSIT_CONFIRMED"
+	TopicWithdrawalRequested Topic = "WITHDRAWAL_REQUESTED"
+	TopicWithdrawalSettled   Topic = "WITHDRAWAL_SETTLED"
+	TopicWithdrawalFailed    Topic = "WITHDRAWAL_FAILED"
+)
+
+// OutboxEvent is one row of the durable event_outbox: a Topic, its
+// marshaled payload, and the shipped flag the background dispatcher
+// flips once ws.Hub.Publish (or a future webhook subscriber) has seen it.
+type OutboxEvent struct {
+	ID          int64     `json:"id"`
+	MarketID    *string   `json:"market_id,omitempty"`
+	Topic       Topic     `json:"topic"`
+	PayloadJSON []byte    `json:"-"`
+	Shipped     bool      `json:"shipped"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type OrderPlacedPayload struct {
+	OrderID string `json:"order_id"`
+	Side    string `json:"side"`
+	Type    string `json:"type"`
+	Price   *int   `json:"price,omitempty"`
+	Qty     int    `json:"qty"`
+	UserID  string `json:"user_id"`
+}
+
+type OrderFilledPayload struct {
+	TradeID    string `json:"trade_id"`
+	Price      int    `json:"price"`
+	Qty        int    `json:"qty"`
+	FeeCents   int64  `json:"fee"`
+	TakerSide  string `json:"taker_side"`
+	MakerOrder string `json:"maker_order"`
+}
+
+type MarketSuspendedPayload struct {
+	Purge bool `json:"purge"`
+}
+
+type MarketResolvedPayload struct {
+	ResolvesTo       string `json:"resolves_to"`
+	AdminID          string `json:"admin_id"`
+	SettledPositions int    `json:"settled_positions"`
+	TotalPayout      int64  `json:"total_payout"`
+}
+
+type DepositConfirmedPayload struct {
+	DepositID     string `json:"deposit_id"`
+	UserID        string `json:"user_id"`
+	AmountCents   int64  `json:"amount_cents"`
+	FeeCents      int64  `json:"fee_cents"`
+	Provider      string `json:"provider"`
+	ExternalTxnID string `json:"external_txn_id"`
+}
+
+// WithdrawalEventPayload covers all three withdrawal topics
+// (TopicWithdrawalRequested/Settled/Failed), which carry the same fields
+// at every stage of the withdrawal's lifecycle.
+type WithdrawalEventPayload struct {
+	WithdrawalID string `json:"withdrawal_id"`
+	UserID       string `json:"user_id"`
+	AmountCents  int64  `json:"amount_cents"`
+	FeeCents     int64  `json:"fee_cents"`
+	Provider     string `json:"provider,omitempty"`
+}
+
 type AnchorBet struct {
 	ID               string    `json:"id"`
 	CreatorUserID    string    `json:"creator_user_id"`
@@ -141,6 +354,26 @@ type SideBet struct {
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+type APIKeyPermission string
+
+const (
+	PermRead  APIKeyPermission = "read"
+	PermTrade APIKeyPermission = "trade"
+	PermAdmin APIKeyPermission = "admin"
+)
+
+type APIKey struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	Key    string `json:"key"`
+	// SecretEnc holds the secret encrypted (not one-way hashed) at rest:
+	// HMAC verification needs the original secret back, unlike password auth.
+	SecretEnc   string             `json:"-"`
+	Permissions []APIKeyPermission `json:"permissions"`
+	IPAllowlist []string           `json:"ip_allowlist,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
 type Promotion struct {
 	ID             string    `json:"id"`
 	AnchorBetID    string    `json:"anchor_bet_id"`
@@ -152,11 +385,21 @@ type Promotion struct {
 // ── API Types ────────────────────────────────────────
 
 type PlaceOrderReq struct {
-	Side          OrderSide `json:"side"`
-	Type          OrderType `json:"type"`
-	PriceCents    *int      `json:"price_cents"`
-	Qty           int       `json:"qty"`
-	ClientOrderID *string   `json:"client_order_id"`
+	Side                OrderSide           `json:"side"`
+	Type                OrderType           `json:"type"`
+	PriceCents          *int                `json:"price_cents"`
+	Qty                 int                 `json:"qty"`
+	ClientOrderID       *string             `json:"client_order_id"`
+	TimeInForce         TimeInForce         `json:"time_in_force"`
+	PostOnly            bool                `json:"post_only"`
+	CancelAfterSeconds  *int                `json:"cancel_after_seconds"`
+	SelfTradePrevention SelfTradePrevention `json:"self_trade_prevention"`
+
+	// DisplayQty makes this an iceberg order: only this much rests
+	// visibly in the book at a time, refreshed from the hidden remainder
+	// as the visible slice is filled. Zero (the default) means the full
+	// Qty is shown, i.e. not an iceberg.
+	DisplayQty int `json:"display_qty"`
 }
 
 type PlaceOrderResult struct {
@@ -166,6 +409,113 @@ type PlaceOrderResult struct {
 	Reason  string      `json:"reason,omitempty"`
 }
 
+// BatchPlaceOrderReq places multiple orders from one user within a single
+// engine tick and DB transaction, e.g. a market maker laddering a book.
+type BatchPlaceOrderReq struct {
+	Orders  []PlaceOrderReq `json:"orders"`
+	GroupID string          `json:"group_id,omitempty"`
+	// AllOrNone rejects every order in the batch if any one of them fails
+	// validation, instead of placing the valid ones and rejecting the rest.
+	AllOrNone bool `json:"all_or_none"`
+	// CancelOnPartial cancels any order left resting on the book once the
+	// batch settles, so a laddering caller gets "fully filled or nothing
+	// resting" rather than a half-filled ladder.
+	CancelOnPartial bool `json:"cancel_on_partial"`
+}
+
+// BatchPlaceOrderResult is the atomic, per-order outcome of a batch
+// placement, tagged with the group id clients used to submit it.
+type BatchPlaceOrderResult struct {
+	GroupID string             `json:"group_id"`
+	Results []PlaceOrderResult `json:"results"`
+}
+
+// BatchRetryPlaceOrderReq places multiple orders from one user
+// independently of one another — unlike BatchPlaceOrderReq, there's no
+// shared transaction or all-or-none semantics, so one order's failure
+// can't roll back or block the rest. Orders that fail for a transient
+// reason are retried on their own with Policy's backoff. Each order
+// should carry its own ClientOrderID, the same way a single retried
+// PlaceOrderWithRetry call needs one, so a retried attempt is idempotent.
+// Mirrors bbgo's BatchPlaceOrders/BatchRetryPlaceOrders split.
+type BatchRetryPlaceOrderReq struct {
+	Orders []PlaceOrderReq `json:"orders"`
+	Policy *RetryPolicy    `json:"policy,omitempty"`
+}
+
+// BatchRetryPlaceOrderResult is the per-order outcome of a
+// BatchRetryPlaceOrderReq, in input order.
+type BatchRetryPlaceOrderResult struct {
+	Results []PlaceOrderResult `json:"results"`
+}
+
+// TradePlacement is one leg of a MultiTradeReq: an order to place in a
+// specific market, tagged with Grouping for the caller's own bookkeeping
+// (e.g. which strategy leg it plays). CounterRateCents, if set, makes the
+// engine automatically post the opposite side at that price once this leg
+// fills in full, e.g. for a market maker that re-quotes after a trade.
+type TradePlacement struct {
+	MarketID         string    `json:"market_id"`
+	Side             OrderSide `json:"side"`
+	PriceCents       *int      `json:"price_cents"`
+	Qty              int       `json:"qty"`
+	Grouping         string    `json:"grouping,omitempty"`
+	CounterRateCents *int      `json:"counter_rate_cents,omitempty"`
+}
+
+// MultiTradeReq places several TradePlacement legs, possibly spanning
+// different markets, as one GroupID-tagged unit that lives or dies
+// together: if any leg fails, every leg already placed is canceled.
+type MultiTradeReq struct {
+	GroupID string           `json:"group_id,omitempty"`
+	Legs    []TradePlacement `json:"legs"`
+}
+
+// MultiTradeResult is the per-leg outcome of a MultiTradeReq, in leg order.
+type MultiTradeResult struct {
+	GroupID string             `json:"group_id"`
+	Results []PlaceOrderResult `json:"results"`
+}
+
+// RetryPolicy controls Manager.PlaceOrderWithRetry's exponential backoff
+// over transient order-placement failures (DB serialization errors, and
+// any REJECTED reason listed in RetryableReasons). Safe to retry only
+// because ClientOrderID uniqueness at the engine layer makes a retried
+// attempt idempotent instead of risking a duplicate fill.
+type RetryPolicy struct {
+	MaxAttempts      int           `json:"max_attempts"`
+	InitialBackoff   time.Duration `json:"initial_backoff"`
+	MaxBackoff       time.Duration `json:"max_backoff"`
+	RetryableReasons []string      `json:"retryable_reasons"`
+}
+
+// DefaultRetryPolicy is a conservative backoff suitable for smoothing
+// over transient Postgres contention during hot resolution windows.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:      3,
+		InitialBackoff:   50 * time.Millisecond,
+		MaxBackoff:       1 * time.Second,
+		RetryableReasons: []string{"internal error", "commit failed", "lock failed"},
+	}
+}
+
+// MarketSnapshot is a point-in-time capture of one market's matching
+// engine state — its resting order book and derived positions — tagged
+// with the seq it was taken at, so boot can skip replaying everything
+// before it instead of scanning the market's full order/trade/event
+// history. PlatformFeeCents is captured for operational visibility only:
+// the platform fee wallet is a single row shared across every market, not
+// something one market's snapshot owns, so it's never restored from here.
+type MarketSnapshot struct {
+	MarketID         string    `json:"market_id"`
+	Seq              int64     `json:"seq"`
+	BookJSON         []byte    `json:"book_json"`
+	PositionsJSON    []byte    `json:"positions_json"`
+	PlatformFeeCents int64     `json:"platform_fee_cents"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
 type BookLevel struct {
 	Price int `json:"price"`
 	Qty   int `json:"qty"`
@@ -176,6 +526,34 @@ type BookSnapshot struct {
 	Asks []BookLevel `json:"asks"`
 }
 
+// Kline is one OHLCV bar for a market/interval bucket.
+type Kline struct {
+	MarketID   string    `json:"market_id"`
+	Interval   string    `json:"interval"`
+	OpenTime   time.Time `json:"open_time"`
+	CloseTime  time.Time `json:"close_time"`
+	Open       int       `json:"open_cents"`
+	High       int       `json:"high_cents"`
+	Low        int       `json:"low_cents"`
+	Close      int       `json:"close_cents"`
+	Volume     int       `json:"volume"`
+	TradeCount int       `json:"trade_count"`
+	Closed     bool      `json:"closed"`
+}
+
+// Epoch is one completed batch-auction round in EPOCH matching mode,
+// persisted so clients can verify the fairness of its random tie-break.
+type Epoch struct {
+	ID            string    `json:"id"`
+	MarketID      string    `json:"market_id"`
+	Seed          int64     `json:"seed"`
+	ClearingCents *int      `json:"clearing_cents,omitempty"`
+	MatchedQty    int       `json:"matched_qty"`
+	OrderIDsHash  string    `json:"order_ids_hash"`
+	StartedAt     time.Time `json:"started_at"`
+	EndedAt       time.Time `json:"ended_at"`
+}
+
 // ── Collateral ───────────────────────────────────────
 
 func CalcLock(side OrderSide, otype OrderType, priceCents *int, qty int, feeBps int) int64 {
@@ -200,3 +578,62 @@ func CalcLock(side OrderSide, otype OrderType, priceCents *int, qty int, feeBps
 func CalcTakerFee(priceCents int, qty int, feeBps int) int64 {
 	return int64(priceCents) * int64(qty) * int64(feeBps) / 10000
 }
+
+// HedgeKind identifies how the markets in a hedge group relate to each
+// other, since the two kinds require different collateral-netting math:
+// in a MUTUALLY_EXCLUSIVE group at most one member resolves YES (the
+// rest auto-resolve NO), while an INVERSE pair's outcomes are logical
+// opposites (resolving one auto-resolves the other to the opposite
+// outcome). Mirrored by engine.HedgeKind, which aliases this type.
+type HedgeKind string
+
+const (
+	HedgeMutuallyExclusive HedgeKind = "MUTUALLY_EXCLUSIVE"
+	HedgeInverse           HedgeKind = "INVERSE"
+)
+
+// HedgePosition is a user's YES-share position in a market hedged against
+// the one an order is being placed in, used by CalcLockWithHedge to
+// discount collateral for correlated exposure.
+type HedgePosition struct {
+	MarketID  string `json:"market_id"`
+	YesShares int    `json:"yes_shares"`
+}
+
+// CalcLockWithHedge is CalcLock adjusted for cross-market hedge coverage.
+//
+// The only sound discount is short-short netting within a
+// MUTUALLY_EXCLUSIVE group: in such a group at most one member resolves
+// YES, so if this market resolves YES every sibling necessarily resolves
+// NO. A sibling position with YesShares < 0 is an existing short,
+// collateralized at 100 cents/share against exactly that NO outcome, so
+// its lock is guaranteed to release the instant this order's SELL
+// obligation comes due — that release can net against this order's new
+// lock. A long (YesShares > 0) sibling position cannot be used the same
+// way: it pays out only if that sibling resolves YES, which is exactly
+// the outcome excluded by this market resolving YES, so it is worth zero
+// collateral precisely when it would be needed.
+//
+// INVERSE pairs get no discount here: covering a short leg there would
+// require the user's NO shares in the paired market, which HedgePosition
+// does not track (only YesShares), so there's nothing sound to net yet.
+//
+// BUY-side collateral is the full upfront cost of the shares, not a
+// contingent payout, so there is nothing for a sibling position to net
+// against; it is returned unchanged from CalcLock.
+func CalcLockWithHedge(side OrderSide, otype OrderType, priceCents *int, qty int, feeBps int, kind HedgeKind, hedgePositions []HedgePosition) int64 {
+	lock := CalcLock(side, otype, priceCents, qty, feeBps)
+	if side != SideSell || kind != HedgeMutuallyExclusive {
+		return lock
+	}
+	var releasable int64
+	for _, hp := range hedgePositions {
+		if hp.YesShares < 0 {
+			releasable += int64(-hp.YesShares) * 100
+		}
+	}
+	if releasable > lock {
+		releasable = lock
+	}
+	return lock - releasable
+}
@@ -0,0 +1,44 @@
+// Package payment abstracts the off-platform rail that settles deposits
+// and withdrawals, so the ledger code in db.Store and the API handlers
+// that wire it up never depend on any one vendor's SDK.
+package payment
+
+import (
+	"context"
+	"fmt"
+)
+
+// Provider is implemented by each funds-movement rail (a real processor
+// like Stripe, or a mock/manual stand-in for dev and tests). Name is
+// persisted on every deposit/withdrawal row so a reconciliation job can
+// tell which rail a given external_txn_id belongs to.
+type Provider interface {
+	Name() string
+
+	// InitiateWithdrawal submits a payout request to the external rail
+	// and returns the reference the rail will use when it later reports
+	// the payout settled or failed. It does not block for settlement.
+	InitiateWithdrawal(ctx context.Context, userID string, amountCents int64) (externalTxnID string, err error)
+}
+
+// Mock is a deterministic Provider for local development and tests: it
+// never calls out anywhere and hands back a predictable reference so
+// withdrawal flows can be exercised end-to-end without a real rail.
+type Mock struct{}
+
+func (Mock) Name() string { return "mock" }
+
+func (Mock) InitiateWithdrawal(ctx context.Context, userID string, amountCents int64) (string, error) {
+	return fmt.Sprintf("mock-%s-%d", userID, amountCents), nil
+}
+
+// Manual is a Provider for rails an operator settles by hand (e.g. a
+// bank wire): InitiateWithdrawal just records that the request exists,
+// leaving the real transfer and its resulting confirm/fail call to ops.
+type Manual struct{}
+
+func (Manual) Name() string { return "manual" }
+
+func (Manual) InitiateWithdrawal(ctx context.Context, userID string, amountCents int64) (string, error) {
+	return "", nil
+}
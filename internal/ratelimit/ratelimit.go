@@ -0,0 +1,132 @@
+// Package ratelimit implements per-identity weighted token buckets, shared
+// by the HTTP API and the WS hub so a caller can't dodge a limit by moving
+// from REST to the websocket's subscribe/unsubscribe ops.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Class buckets endpoints into families that share a limit configuration.
+type Class string
+
+const (
+	ClassPublic  Class = "public"  // read-only market data, listable in bulk
+	ClassTrade   Class = "trade"   // order placement/cancellation
+	ClassAccount Class = "account" // wallet, positions, ws subscribe/unsubscribe
+)
+
+// Role selects which per-class limits apply to a caller.
+type Role string
+
+const (
+	RoleAnon   Role = "anon"   // unauthenticated, bucketed by remote IP
+	RoleUser   Role = "user"   // JWT-authenticated user
+	RoleAPIKey Role = "apikey" // signed API key, assumed bot/market-maker traffic
+	RoleAdmin  Role = "admin"
+)
+
+type config struct {
+	capacity     float64
+	refillPerSec float64
+}
+
+// limits maps role -> class -> bucket config. Admins and API keys get
+// higher ceilings than anonymous or plain JWT callers; anon has no trade
+// bucket at all since every trade route requires auth upstream of this.
+var limits = map[Role]map[Class]config{
+	RoleAnon: {
+		ClassPublic:  {capacity: 60, refillPerSec: 1},
+		ClassAccount: {capacity: 30, refillPerSec: 0.5},
+	},
+	RoleUser: {
+		ClassPublic:  {capacity: 300, refillPerSec: 5},
+		ClassTrade:   {capacity: 60, refillPerSec: 1},
+		ClassAccount: {capacity: 120, refillPerSec: 2},
+	},
+	RoleAPIKey: {
+		ClassPublic:  {capacity: 600, refillPerSec: 10},
+		ClassTrade:   {capacity: 300, refillPerSec: 5},
+		ClassAccount: {capacity: 300, refillPerSec: 5},
+	},
+	RoleAdmin: {
+		ClassPublic:  {capacity: 1000, refillPerSec: 20},
+		ClassTrade:   {capacity: 1000, refillPerSec: 20},
+		ClassAccount: {capacity: 1000, refillPerSec: 20},
+	},
+}
+
+type bucket struct {
+	mu        sync.Mutex
+	tokens    float64
+	updatedAt time.Time
+}
+
+// Limiter holds one token bucket per (role, class, identity) triple.
+type Limiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+func New() *Limiter {
+	return &Limiter{buckets: make(map[string]*bucket)}
+}
+
+// Result reports the outcome of an Allow check, enough to build the
+// standard X-RateLimit-* response headers.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	ResetAt   time.Time
+}
+
+// Allow charges weight tokens from identity's (role, class) bucket,
+// refilling it first based on elapsed time since the last check. A class
+// with no configured bucket for role (e.g. trade for an anonymous caller)
+// is denied outright rather than treated as unlimited.
+func (l *Limiter) Allow(identity string, role Role, class Class, weight int) Result {
+	cfg, ok := limits[role][class]
+	if !ok {
+		return Result{Allowed: false, ResetAt: time.Now()}
+	}
+
+	key := string(role) + "|" + string(class) + "|" + identity
+	l.mu.Lock()
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: cfg.capacity, updatedAt: time.Now()}
+		l.buckets[key] = b
+	}
+	l.mu.Unlock()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens += now.Sub(b.updatedAt).Seconds() * cfg.refillPerSec
+	if b.tokens > cfg.capacity {
+		b.tokens = cfg.capacity
+	}
+	b.updatedAt = now
+
+	allowed := b.tokens >= float64(weight)
+	if allowed {
+		b.tokens -= float64(weight)
+	}
+
+	remaining := int(b.tokens)
+	if remaining < 0 {
+		remaining = 0
+	}
+	var resetIn time.Duration
+	if cfg.refillPerSec > 0 {
+		resetIn = time.Duration((cfg.capacity - b.tokens) / cfg.refillPerSec * float64(time.Second))
+	}
+	return Result{
+		Allowed:   allowed,
+		Limit:     int(cfg.capacity),
+		Remaining: remaining,
+		ResetAt:   now.Add(resetIn),
+	}
+}
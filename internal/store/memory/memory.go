@@ -0,0 +1,604 @@
+// Package memory is a map-backed store.Store for engine unit tests: no
+// Postgres, no migrations, just maps guarded by a mutex. It's meant for
+// tests that construct fresh state per case, not for production traffic.
+//
+// BeginTx returns a Tx that holds the store's lock until Commit or
+// Rollback releases it; unlike store/pg's real database transactions,
+// mutations made under the lock are applied immediately rather than
+// staged, so Rollback only releases the lock — it can't undo whatever
+// ran before it was called. That's fine for hermetic tests, which don't
+// rely on mid-transaction failure leaving prior state untouched the way
+// a production Postgres rollback would.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"wager-exchange/internal/model"
+	"wager-exchange/internal/store"
+)
+
+// Store is an in-memory store.Store.
+type Store struct {
+	mu sync.Mutex
+
+	users       map[string]*model.User
+	usersByMail map[string]string // email -> user id
+	wallets     map[string]*model.Wallet
+	markets     map[string]*model.Market
+	orders      map[string]*model.Order
+	trades      []model.Trade
+	positions   map[string]*model.Position // marketID + "|" + userID
+	events      []model.EventLog
+	outbox      []model.OutboxEvent
+	klines      map[string]*model.Kline // marketID + "|" + interval + "|" + openTime
+	epochs      []model.Epoch
+	snapshots   map[string]*model.MarketSnapshot // marketID -> latest
+	platformFee int64
+}
+
+// New returns an empty Store ready for use.
+func New() *Store {
+	return &Store{
+		users:       make(map[string]*model.User),
+		usersByMail: make(map[string]string),
+		wallets:     make(map[string]*model.Wallet),
+		markets:     make(map[string]*model.Market),
+		orders:      make(map[string]*model.Order),
+		positions:   make(map[string]*model.Position),
+		klines:      make(map[string]*model.Kline),
+		snapshots:   make(map[string]*model.MarketSnapshot),
+	}
+}
+
+// Tx is memory's lock-holding transaction handle; see the package doc.
+// done guards against unlocking twice: the repo-wide idiom is
+// `defer tx.Rollback()` right after BeginTx, then tx.Commit() on the
+// success path, which is a harmless no-op against *sql.Tx but would
+// otherwise unlock s.mu a second time here.
+type Tx struct {
+	s    *Store
+	done bool
+}
+
+func (t *Tx) Commit() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	t.s.mu.Unlock()
+	return nil
+}
+
+func (t *Tx) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	t.s.mu.Unlock()
+	return nil
+}
+
+func (s *Store) BeginTx(ctx context.Context) (store.Tx, error) {
+	s.mu.Lock()
+	return &Tx{s: s}, nil
+}
+
+// ── Users ────────────────────────────────────────────
+
+func (s *Store) GetUser(ctx context.Context, id string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.users[id], nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.usersByMail[email]
+	if !ok {
+		return nil, nil
+	}
+	return s.users[id], nil
+}
+
+// PutUser seeds a user directly; test setup helper, not part of store.Store.
+func (s *Store) PutUser(u *model.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[u.ID] = u
+	s.usersByMail[u.Email] = u.ID
+}
+
+// ── Wallets ──────────────────────────────────────────
+
+func (s *Store) CreateWallet(ctx context.Context, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.wallets[userID] = &model.Wallet{UserID: userID}
+	return nil
+}
+
+func (s *Store) GetWallet(ctx context.Context, userID string) (*model.Wallet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w := s.wallets[userID]
+	if w == nil {
+		return nil, nil
+	}
+	cp := *w
+	return &cp, nil
+}
+
+func (s *Store) GetWalletForUpdate(tx store.Tx, userID string) (*model.Wallet, error) {
+	w, ok := s.wallets[userID]
+	if !ok {
+		return nil, fmt.Errorf("wallet not found: %s", userID)
+	}
+	cp := *w
+	return &cp, nil
+}
+
+func (s *Store) WalletAddLocked(tx store.Tx, userID string, delta int64) error {
+	w, ok := s.wallets[userID]
+	if !ok {
+		return fmt.Errorf("wallet not found: %s", userID)
+	}
+	w.LockedCents += delta
+	return nil
+}
+
+func (s *Store) WalletAddBalance(tx store.Tx, userID string, delta int64) error {
+	w, ok := s.wallets[userID]
+	if !ok {
+		return fmt.Errorf("wallet not found: %s", userID)
+	}
+	w.BalanceCents += delta
+	return nil
+}
+
+func (s *Store) RecalcLocked(tx store.Tx, userID string) error {
+	w, ok := s.wallets[userID]
+	if !ok {
+		return fmt.Errorf("wallet not found: %s", userID)
+	}
+	var orderLock int64
+	for _, o := range s.orders {
+		if o.UserID == userID && (o.Status == model.StatusOpen || o.Status == model.StatusPartial) {
+			orderLock += o.LockedCents
+		}
+	}
+	var posLock int64
+	for _, p := range s.positions {
+		if p.UserID == userID && p.YesShares < 0 {
+			posLock += int64(-p.YesShares) * 100
+		}
+	}
+	w.LockedCents = orderLock + posLock
+	return nil
+}
+
+// ── Markets ──────────────────────────────────────────
+
+func (s *Store) CreateMarket(ctx context.Context, slug, title, desc string, tick int, matchingMode model.MatchingMode, epochDurationMs int) (*model.Market, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := &model.Market{
+		ID: fmt.Sprintf("mkt-%d", len(s.markets)+1), Slug: slug, Title: title, Description: desc,
+		Status: model.MarketOpen, TickSizeCents: tick, CreatedAt: time.Now(),
+		Instrument: model.DefaultInstrument(), MatchingMode: matchingMode, EpochDurationMs: epochDurationMs,
+	}
+	s.markets[m.ID] = m
+	return m, nil
+}
+
+func (s *Store) ListMarkets(ctx context.Context) ([]model.Market, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]model.Market, 0, len(s.markets))
+	for _, m := range s.markets {
+		out = append(out, *m)
+	}
+	return out, nil
+}
+
+func (s *Store) GetMarket(ctx context.Context, id string) (*model.Market, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m := s.markets[id]
+	if m == nil {
+		return nil, nil
+	}
+	cp := *m
+	return &cp, nil
+}
+
+func (s *Store) GetOpenMarkets(ctx context.Context) ([]model.Market, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Market
+	for _, m := range s.markets {
+		if m.Status == model.MarketOpen || m.Status == model.MarketSuspended {
+			out = append(out, *m)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) UpdateMarketInstrument(tx store.Tx, marketID string, instr model.Instrument) error {
+	m, ok := s.markets[marketID]
+	if !ok {
+		return fmt.Errorf("market not found: %s", marketID)
+	}
+	m.Instrument = instr
+	return nil
+}
+
+func (s *Store) ScheduleMarketSuspension(tx store.Tx, marketID string, suspendAt time.Time, purge bool) error {
+	m, ok := s.markets[marketID]
+	if !ok {
+		return fmt.Errorf("market not found: %s", marketID)
+	}
+	m.SuspendAt = &suspendAt
+	m.SuspendPurge = purge
+	return nil
+}
+
+func (s *Store) SuspendMarketNow(tx store.Tx, marketID string) error {
+	m, ok := s.markets[marketID]
+	if !ok {
+		return fmt.Errorf("market not found: %s", marketID)
+	}
+	m.Status = model.MarketSuspended
+	m.SuspendAt = nil
+	return nil
+}
+
+func (s *Store) ResumeMarket(tx store.Tx, marketID string) error {
+	m, ok := s.markets[marketID]
+	if !ok {
+		return fmt.Errorf("market not found: %s", marketID)
+	}
+	m.Status = model.MarketOpen
+	m.SuspendAt = nil
+	m.SuspendPurge = false
+	return nil
+}
+
+func (s *Store) ResolveMarket(tx store.Tx, marketID, resolvesTo string) error {
+	m, ok := s.markets[marketID]
+	if !ok {
+		return fmt.Errorf("market not found: %s", marketID)
+	}
+	m.Status = model.MarketResolved
+	m.ResolvesTo = &resolvesTo
+	now := time.Now()
+	m.ResolvedAt = &now
+	return nil
+}
+
+// ── Orders ───────────────────────────────────────────
+
+func (s *Store) InsertOrder(tx store.Tx, o *model.Order) error {
+	cp := *o
+	cp.CreatedAt = time.Now()
+	cp.UpdatedAt = cp.CreatedAt
+	s.orders[o.ID] = &cp
+	return nil
+}
+
+// BatchInsertOrders mirrors db.BatchInsertOrders: every order lands as a
+// single batch, but since this store has no round trip to economize on
+// it's just InsertOrder in a loop.
+func (s *Store) BatchInsertOrders(tx store.Tx, orders []*model.Order) error {
+	for _, o := range orders {
+		if err := s.InsertOrder(tx, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) UpdateOrderFill(tx store.Tx, orderID string, remainingQty int, lockedCents int64, status model.OrderStatus) error {
+	o, ok := s.orders[orderID]
+	if !ok {
+		return fmt.Errorf("order not found: %s", orderID)
+	}
+	o.RemainingQty = remainingQty
+	o.LockedCents = lockedCents
+	o.Status = status
+	o.UpdatedAt = time.Now()
+	return nil
+}
+
+// CancelOrderTx mirrors db.CancelOrderTx: it cancels orderID and returns
+// the locked_cents it held just before cancellation, captured before the
+// zeroing below so the caller can release the right amount.
+func (s *Store) CancelOrderTx(tx store.Tx, orderID string) (int64, error) {
+	o, ok := s.orders[orderID]
+	if !ok {
+		return 0, fmt.Errorf("order not found: %s", orderID)
+	}
+	locked := o.LockedCents
+	o.Status = model.StatusCanceled
+	o.RemainingQty = 0
+	o.LockedCents = 0
+	o.UpdatedAt = time.Now()
+	return locked, nil
+}
+
+func (s *Store) GetOpenOrders(ctx context.Context, marketID string) ([]model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Order
+	for _, o := range s.orders {
+		if o.MarketID == marketID && (o.Status == model.StatusOpen || o.Status == model.StatusPartial) {
+			out = append(out, *o)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetOrder(ctx context.Context, id string) (*model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orders[id]
+	if o == nil {
+		return nil, nil
+	}
+	cp := *o
+	return &cp, nil
+}
+
+func (s *Store) GetOrderByClientID(ctx context.Context, marketID, userID, clientOrderID string) (*model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, o := range s.orders {
+		if o.MarketID == marketID && o.UserID == userID && o.ClientOrderID != nil && *o.ClientOrderID == clientOrderID {
+			cp := *o
+			return &cp, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Store) MaxSeq(ctx context.Context, marketID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var max int64
+	for _, o := range s.orders {
+		if o.MarketID == marketID && o.Seq > max {
+			max = o.Seq
+		}
+	}
+	for _, t := range s.trades {
+		if t.MarketID == marketID && t.Seq > max {
+			max = t.Seq
+		}
+	}
+	for _, ev := range s.events {
+		if ev.Seq != nil && ev.MarketID != nil && *ev.MarketID == marketID && *ev.Seq > max {
+			max = *ev.Seq
+		}
+	}
+	return max, nil
+}
+
+// GetOrdersSince returns every order for marketID with seq greater than
+// sinceSeq, regardless of status; mirrors db.Store.GetOrdersSince.
+func (s *Store) GetOrdersSince(ctx context.Context, marketID string, sinceSeq int64) ([]model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Order
+	for _, o := range s.orders {
+		if o.MarketID == marketID && o.Seq > sinceSeq {
+			out = append(out, *o)
+		}
+	}
+	return out, nil
+}
+
+// MaxSeqSince is MaxSeq scoped to rows newer than sinceSeq; mirrors
+// db.Store.MaxSeqSince.
+func (s *Store) MaxSeqSince(ctx context.Context, marketID string, sinceSeq int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	max := sinceSeq
+	for _, o := range s.orders {
+		if o.MarketID == marketID && o.Seq > sinceSeq && o.Seq > max {
+			max = o.Seq
+		}
+	}
+	for _, t := range s.trades {
+		if t.MarketID == marketID && t.Seq > sinceSeq && t.Seq > max {
+			max = t.Seq
+		}
+	}
+	for _, ev := range s.events {
+		if ev.Seq != nil && ev.MarketID != nil && *ev.MarketID == marketID && *ev.Seq > sinceSeq && *ev.Seq > max {
+			max = *ev.Seq
+		}
+	}
+	return max, nil
+}
+
+// ── Trades ───────────────────────────────────────────
+
+func (s *Store) InsertTrade(tx store.Tx, t *model.Trade) error {
+	s.trades = append(s.trades, *t)
+	return nil
+}
+
+func (s *Store) ListTrades(ctx context.Context, marketID string, limit int) ([]model.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Trade
+	for i := len(s.trades) - 1; i >= 0 && len(out) < limit; i-- {
+		if s.trades[i].MarketID == marketID {
+			out = append(out, s.trades[i])
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) GetTradesForOrder(ctx context.Context, orderID string) ([]model.Trade, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Trade
+	for _, t := range s.trades {
+		if t.MakerOrderID == orderID || t.TakerOrderID == orderID {
+			out = append(out, t)
+		}
+	}
+	return out, nil
+}
+
+// ── Positions ────────────────────────────────────────
+
+func posKey(marketID, userID string) string { return marketID + "|" + userID }
+
+func (s *Store) GetPositionsForUpdate(tx store.Tx, userID string, marketIDs []string) ([]model.Position, error) {
+	var out []model.Position
+	for _, marketID := range marketIDs {
+		if p, ok := s.positions[posKey(marketID, userID)]; ok {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+func (s *Store) UpsertPosition(tx store.Tx, marketID, userID string, sharesDelta int) error {
+	key := posKey(marketID, userID)
+	p, ok := s.positions[key]
+	if !ok {
+		p = &model.Position{MarketID: marketID, UserID: userID}
+		s.positions[key] = p
+	}
+	p.YesShares += sharesDelta
+	return nil
+}
+
+func (s *Store) ListPositions(ctx context.Context, marketID string) ([]model.Position, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.Position
+	for _, p := range s.positions {
+		if p.MarketID == marketID {
+			out = append(out, *p)
+		}
+	}
+	return out, nil
+}
+
+// ── Events ───────────────────────────────────────────
+
+func (s *Store) AppendEvent(tx store.Tx, marketID *string, seq *int64, evType string, payload any) error {
+	s.events = append(s.events, model.EventLog{
+		ID: int64(len(s.events) + 1), MarketID: marketID, Seq: seq,
+		Type: evType, PayloadJSON: payload, CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+// PublishEvent mirrors db.PublishEvent: it records the event as an
+// outbox entry rather than appending to events, since the outbox and
+// event_log are separate tables in Postgres. Payload is marshaled to
+// JSON to match what a real subscriber would receive.
+func (s *Store) PublishEvent(tx store.Tx, marketID *string, topic model.Topic, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	s.outbox = append(s.outbox, model.OutboxEvent{
+		ID: int64(len(s.outbox) + 1), MarketID: marketID, Topic: topic,
+		PayloadJSON: b, CreatedAt: time.Now(),
+	})
+	return nil
+}
+
+func (s *Store) ListEvents(ctx context.Context, marketID *string, limit int) ([]model.EventLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []model.EventLog
+	for i := len(s.events) - 1; i >= 0 && len(out) < limit; i-- {
+		ev := s.events[i]
+		if marketID == nil || (ev.MarketID != nil && *ev.MarketID == *marketID) {
+			out = append(out, ev)
+		}
+	}
+	return out, nil
+}
+
+// ── Klines and epochs ────────────────────────────────
+
+func klineKey(marketID, interval string, openTime time.Time) string {
+	return marketID + "|" + interval + "|" + openTime.String()
+}
+
+// UpsertKline mirrors db.UpsertKline's ON CONFLICT merge: a bar already
+// open for this market/interval/openTime gets its high/low/close/volume
+// merged in, otherwise a new bar is inserted.
+func (s *Store) UpsertKline(tx store.Tx, k *model.Kline) error {
+	key := klineKey(k.MarketID, k.Interval, k.OpenTime)
+	existing, ok := s.klines[key]
+	if !ok {
+		cp := *k
+		s.klines[key] = &cp
+		return nil
+	}
+	if k.High > existing.High {
+		existing.High = k.High
+	}
+	if k.Low < existing.Low {
+		existing.Low = k.Low
+	}
+	existing.Close = k.Close
+	existing.Volume += k.Volume
+	existing.TradeCount += k.TradeCount
+	return nil
+}
+
+func (s *Store) InsertEpoch(tx store.Tx, ep *model.Epoch) error {
+	s.epochs = append(s.epochs, *ep)
+	return nil
+}
+
+// ── Market snapshots ─────────────────────────────────
+
+func (s *Store) SaveSnapshot(tx store.Tx, marketID string, seq int64, bookJSON, positionsJSON []byte, platformFeeCents int64) error {
+	s.snapshots[marketID] = &model.MarketSnapshot{
+		MarketID: marketID, Seq: seq, BookJSON: bookJSON, PositionsJSON: positionsJSON,
+		PlatformFeeCents: platformFeeCents, CreatedAt: time.Now(),
+	}
+	return nil
+}
+
+func (s *Store) LatestSnapshot(ctx context.Context, marketID string) (*model.MarketSnapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[marketID]
+	if !ok {
+		return nil, nil
+	}
+	cp := *snap
+	return &cp, nil
+}
+
+// ── Platform fee wallet ──────────────────────────────
+
+func (s *Store) GetPlatformFee(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.platformFee, nil
+}
+
+func (s *Store) AddPlatformFee(tx store.Tx, cents int64) error {
+	s.platformFee += cents
+	return nil
+}
+
+var _ store.Store = (*Store)(nil)
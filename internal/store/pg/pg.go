@@ -0,0 +1,123 @@
+// Package pg adapts the existing db.Store (Postgres via database/sql) to
+// the store.Store interface. It's a thin wrapper: every method delegates
+// straight to the db package's existing code, type-asserting the store.Tx
+// handle back to the *sql.Tx the db package's helpers expect. Production
+// wiring is unchanged by this package existing — cmd/server/main.go still
+// constructs a *db.Store directly; pg.Store exists so anything written
+// against store.Store (e.g. a future engine test harness) can run against
+// real Postgres when that's what the test wants.
+package pg
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"wager-exchange/internal/db"
+	"wager-exchange/internal/model"
+	"wager-exchange/internal/store"
+)
+
+// Store wraps a *db.Store to satisfy store.Store.
+type Store struct {
+	*db.Store
+}
+
+// New wraps an existing db.Store for callers that already constructed one.
+func New(s *db.Store) *Store { return &Store{Store: s} }
+
+func (s *Store) BeginTx(ctx context.Context) (store.Tx, error) {
+	return s.Store.BeginTx(ctx)
+}
+
+func (s *Store) GetWalletForUpdate(tx store.Tx, userID string) (*model.Wallet, error) {
+	return s.Store.GetWalletForUpdate(tx.(*sql.Tx), userID)
+}
+
+func (s *Store) WalletAddLocked(tx store.Tx, userID string, delta int64) error {
+	return db.WalletAddLocked(tx.(*sql.Tx), userID, delta)
+}
+
+func (s *Store) WalletAddBalance(tx store.Tx, userID string, delta int64) error {
+	return db.WalletAddBalance(tx.(*sql.Tx), userID, delta)
+}
+
+func (s *Store) RecalcLocked(tx store.Tx, userID string) error {
+	return db.RecalcLocked(tx.(*sql.Tx), userID)
+}
+
+func (s *Store) UpdateMarketInstrument(tx store.Tx, marketID string, instr model.Instrument) error {
+	return db.UpdateMarketInstrument(tx.(*sql.Tx), marketID, instr)
+}
+
+func (s *Store) ScheduleMarketSuspension(tx store.Tx, marketID string, suspendAt time.Time, purge bool) error {
+	return db.ScheduleMarketSuspension(tx.(*sql.Tx), marketID, suspendAt, purge)
+}
+
+func (s *Store) SuspendMarketNow(tx store.Tx, marketID string) error {
+	return db.SuspendMarketNow(tx.(*sql.Tx), marketID)
+}
+
+func (s *Store) ResumeMarket(tx store.Tx, marketID string) error {
+	return db.ResumeMarket(tx.(*sql.Tx), marketID)
+}
+
+func (s *Store) ResolveMarket(tx store.Tx, marketID, resolvesTo string) error {
+	return db.ResolveMarket(tx.(*sql.Tx), marketID, resolvesTo)
+}
+
+func (s *Store) InsertOrder(tx store.Tx, o *model.Order) error {
+	return db.InsertOrder(tx.(*sql.Tx), o)
+}
+
+func (s *Store) UpdateOrderFill(tx store.Tx, orderID string, remainingQty int, lockedCents int64, status model.OrderStatus) error {
+	return db.UpdateOrderFill(tx.(*sql.Tx), orderID, remainingQty, lockedCents, status)
+}
+
+func (s *Store) CancelOrderTx(tx store.Tx, orderID string) (int64, error) {
+	return db.CancelOrderTx(tx.(*sql.Tx), orderID)
+}
+
+func (s *Store) InsertTrade(tx store.Tx, t *model.Trade) error {
+	return db.InsertTrade(tx.(*sql.Tx), t)
+}
+
+func (s *Store) GetPositionsForUpdate(tx store.Tx, userID string, marketIDs []string) ([]model.Position, error) {
+	return s.Store.GetPositionsForUpdate(tx.(*sql.Tx), userID, marketIDs)
+}
+
+func (s *Store) UpsertPosition(tx store.Tx, marketID, userID string, sharesDelta int) error {
+	return db.UpsertPosition(tx.(*sql.Tx), marketID, userID, sharesDelta)
+}
+
+func (s *Store) AppendEvent(tx store.Tx, marketID *string, seq *int64, evType string, payload any) error {
+	return db.AppendEvent(tx.(*sql.Tx), marketID, seq, evType, payload)
+}
+
+func (s *Store) AddPlatformFee(tx store.Tx, cents int64) error {
+	return db.AddPlatformFee(tx.(*sql.Tx), cents)
+}
+
+func (s *Store) BatchInsertOrders(tx store.Tx, orders []*model.Order) error {
+	return db.BatchInsertOrders(tx.(*sql.Tx), orders)
+}
+
+// PublishEvent forwards to db.PublishEvent's generic [T any], instantiated
+// with any since store.Store's method can't itself be generic.
+func (s *Store) PublishEvent(tx store.Tx, marketID *string, topic model.Topic, payload any) error {
+	return db.PublishEvent(tx.(*sql.Tx), marketID, topic, payload)
+}
+
+func (s *Store) UpsertKline(tx store.Tx, k *model.Kline) error {
+	return db.UpsertKline(tx.(*sql.Tx), k)
+}
+
+func (s *Store) InsertEpoch(tx store.Tx, ep *model.Epoch) error {
+	return db.InsertEpoch(tx.(*sql.Tx), ep)
+}
+
+func (s *Store) SaveSnapshot(tx store.Tx, marketID string, seq int64, bookJSON, positionsJSON []byte, platformFeeCents int64) error {
+	return db.SaveSnapshot(tx.(*sql.Tx), marketID, seq, bookJSON, positionsJSON, platformFeeCents)
+}
+
+var _ store.Store = (*Store)(nil)
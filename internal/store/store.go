@@ -0,0 +1,104 @@
+// Package store defines the storage abstraction the matching engine and
+// settlement path run against, so engine unit tests can swap a real
+// Postgres-backed store.Store for store/memory's map-backed one instead
+// of spinning up a database. store/pg wraps the existing db.Store/*sql.Tx
+// code so production wiring is unchanged; store/memory is a from-scratch
+// implementation for tests.
+//
+// This mirrors the moneygo "split DB activity into store" refactor. The
+// interface below covers what engine.Manager, engine.MarketEngine, and
+// the settlement path (resolveMarket, applySuspension, cancelOrder, ...)
+// actually call today — users, wallets, markets, orders, trades,
+// positions, events, and the platform fee wallet. Request/API-key/kline
+// history and anchor/side bets stay behind *db.Store directly for now;
+// those surfaces don't sit on the matching engine's hot path, so they
+// don't need a hermetic test double yet.
+package store
+
+import (
+	"context"
+	"time"
+
+	"wager-exchange/internal/model"
+)
+
+// Tx is an open transaction handle. It carries no query methods of its
+// own — store/pg's Tx is a concrete *sql.Tx under the hood and store/pg's
+// Store methods know how to use it; store/memory's Tx only holds that
+// store's lock until Commit or Rollback, since its Store methods mutate
+// the in-memory maps directly rather than issuing queries against the
+// handle.
+type Tx interface {
+	Commit() error
+	Rollback() error
+}
+
+// Store is the storage interface the matching engine depends on.
+type Store interface {
+	BeginTx(ctx context.Context) (Tx, error)
+
+	// Users
+	GetUser(ctx context.Context, id string) (*model.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*model.User, error)
+
+	// Wallets
+	CreateWallet(ctx context.Context, userID string) error
+	GetWallet(ctx context.Context, userID string) (*model.Wallet, error)
+	GetWalletForUpdate(tx Tx, userID string) (*model.Wallet, error)
+	WalletAddLocked(tx Tx, userID string, delta int64) error
+	WalletAddBalance(tx Tx, userID string, delta int64) error
+	RecalcLocked(tx Tx, userID string) error
+
+	// Markets
+	CreateMarket(ctx context.Context, slug, title, desc string, tick int, matchingMode model.MatchingMode, epochDurationMs int) (*model.Market, error)
+	ListMarkets(ctx context.Context) ([]model.Market, error)
+	GetMarket(ctx context.Context, id string) (*model.Market, error)
+	GetOpenMarkets(ctx context.Context) ([]model.Market, error)
+	UpdateMarketInstrument(tx Tx, marketID string, instr model.Instrument) error
+	ScheduleMarketSuspension(tx Tx, marketID string, suspendAt time.Time, purge bool) error
+	SuspendMarketNow(tx Tx, marketID string) error
+	ResumeMarket(tx Tx, marketID string) error
+	ResolveMarket(tx Tx, marketID, resolvesTo string) error
+
+	// Orders
+	InsertOrder(tx Tx, o *model.Order) error
+	BatchInsertOrders(tx Tx, orders []*model.Order) error
+	UpdateOrderFill(tx Tx, orderID string, remainingQty int, lockedCents int64, status model.OrderStatus) error
+	CancelOrderTx(tx Tx, orderID string) (int64, error)
+	GetOpenOrders(ctx context.Context, marketID string) ([]model.Order, error)
+	GetOrdersSince(ctx context.Context, marketID string, sinceSeq int64) ([]model.Order, error)
+	GetOrder(ctx context.Context, id string) (*model.Order, error)
+	GetOrderByClientID(ctx context.Context, marketID, userID, clientOrderID string) (*model.Order, error)
+	MaxSeq(ctx context.Context, marketID string) (int64, error)
+	MaxSeqSince(ctx context.Context, marketID string, sinceSeq int64) (int64, error)
+
+	// Trades
+	InsertTrade(tx Tx, t *model.Trade) error
+	ListTrades(ctx context.Context, marketID string, limit int) ([]model.Trade, error)
+	GetTradesForOrder(ctx context.Context, orderID string) ([]model.Trade, error)
+
+	// Positions
+	GetPositionsForUpdate(tx Tx, userID string, marketIDs []string) ([]model.Position, error)
+	UpsertPosition(tx Tx, marketID, userID string, sharesDelta int) error
+	ListPositions(ctx context.Context, marketID string) ([]model.Position, error)
+
+	// Events. PublishEvent takes payload as any rather than using
+	// db.PublishEvent's generic [T any] signature directly, since
+	// interface methods can't themselves be generic.
+	AppendEvent(tx Tx, marketID *string, seq *int64, evType string, payload any) error
+	PublishEvent(tx Tx, marketID *string, topic model.Topic, payload any) error
+	ListEvents(ctx context.Context, marketID *string, limit int) ([]model.EventLog, error)
+
+	// Klines and epochs, needed by the matching engine's own bookkeeping
+	// (not the REST history surface, which stays behind *db.Store).
+	UpsertKline(tx Tx, k *model.Kline) error
+	InsertEpoch(tx Tx, ep *model.Epoch) error
+
+	// Market snapshots
+	SaveSnapshot(tx Tx, marketID string, seq int64, bookJSON, positionsJSON []byte, platformFeeCents int64) error
+	LatestSnapshot(ctx context.Context, marketID string) (*model.MarketSnapshot, error)
+
+	// Platform fee wallet
+	GetPlatformFee(ctx context.Context) (int64, error)
+	AddPlatformFee(tx Tx, cents int64) error
+}
@@ -3,61 +3,266 @@ package ws
 import (
 	"encoding/json"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gorilla/websocket"
+
+	"wager-exchange/internal/model"
+	"wager-exchange/internal/ratelimit"
 )
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool { return true },
 }
 
-// Msg is a message sent to clients.
+const (
+	pingInterval  = 20 * time.Second
+	pongMissLimit = 2 // drop the connection after this many missed pongs
+	sendQueueSize = 64
+)
+
+// BookSource lets the hub push an orderbook snapshot without importing the
+// engine package directly, mirroring how engine.PublishFunc decouples the
+// engine from ws.
+type BookSource func(marketID string) (bids, asks []model.BookLevel)
+
+// Msg is a message sent to clients over a subscribed channel.
 type Msg struct {
-	Type     string `json:"type"`
-	MarketID string `json:"market_id"`
-	Data     any    `json:"data"`
+	Topic string `json:"topic,omitempty"` // e.g. "orderbook.10.MKT1"
+	Type  string `json:"type"`            // "snapshot" | "delta" | "op" reply | ...
+	Data  any    `json:"data,omitempty"`
+	Seq   int64  `json:"seq,omitempty"`
+	Ts    int64  `json:"ts"`
 }
 
-// Hub manages per-market WebSocket subscriptions.
+// subReply acknowledges a subscribe/unsubscribe op, matching the
+// Bybit-style {"op":"subscribe","args":[...]} request/response shape.
+type subReply struct {
+	Op      string   `json:"op"`
+	Args    []string `json:"args"`
+	Success bool     `json:"success"`
+}
+
+// channel identifies a parsed subscription argument, e.g.
+// "orderbook.10.MKT1" -> {Kind: "orderbook", Param: "10", MarketID: "MKT1"}.
+type channel struct {
+	Kind     string // orderbook | publicTrade | tickers | kline
+	Param    string // depth for orderbook, interval for kline, "" otherwise
+	MarketID string
+}
+
+func (c channel) key() string { return c.Kind + "." + c.Param + "." + c.MarketID }
+
+func parseChannel(arg string) (channel, bool) {
+	parts := strings.Split(arg, ".")
+	switch parts[0] {
+	case "orderbook":
+		if len(parts) != 3 {
+			return channel{}, false
+		}
+		return channel{Kind: "orderbook", Param: parts[1], MarketID: parts[2]}, true
+	case "kline":
+		if len(parts) != 3 {
+			return channel{}, false
+		}
+		return channel{Kind: "kline", Param: parts[1], MarketID: parts[2]}, true
+	case "publicTrade", "tickers":
+		if len(parts) != 2 {
+			return channel{}, false
+		}
+		return channel{Kind: parts[0], MarketID: parts[1]}, true
+	default:
+		return channel{}, false
+	}
+}
+
+// Hub manages per-channel WebSocket subscriptions.
 type Hub struct {
 	mu      sync.RWMutex
-	rooms   map[string]map[*conn]bool // marketID -> set of conns
-	allConn map[*conn]bool
+	conns   map[*conn]bool
+	byChan  map[string]map[*conn]bool // channel key -> subscribers
+	seq     map[string]int64          // channel key -> last sequence sent
+	lastTrd   map[string]any // marketID -> last trade payload, for tickers
+	lastKline map[string]any // channel key -> last kline payload, for late subscribers
+
+	bookSrc BookSource
+	limiter *ratelimit.Limiter
+
+	dropped     atomic.Int64 // messages dropped to slow/backpressured clients
+	rateLimited atomic.Int64 // subscribe/unsubscribe ops rejected by the limiter
 }
 
 type conn struct {
-	ws     *websocket.Conn
-	send   chan []byte
-	hub    *Hub
-	market string
+	ws         *websocket.Conn
+	send       chan []byte
+	hub        *Hub
+	chans      map[string]channel
+	mu         sync.Mutex
+	missed     int32
+	remoteAddr string
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		rooms:   make(map[string]map[*conn]bool),
-		allConn: make(map[*conn]bool),
+		conns:     make(map[*conn]bool),
+		byChan:    make(map[string]map[*conn]bool),
+		seq:       make(map[string]int64),
+		lastTrd:   make(map[string]any),
+		lastKline: make(map[string]any),
 	}
 }
 
-// Publish sends a message to all subscribers of a market.
+// SetBookSource wires the function used to produce an orderbook/ticker
+// snapshot on subscribe. Must be called once during startup wiring.
+func (h *Hub) SetBookSource(src BookSource) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.bookSrc = src
+}
+
+// SetLimiter wires the shared rate limiter so subscribe/unsubscribe ops
+// are charged against the same account bucket as the REST API, keyed by
+// the connection's remote address since WS connections aren't
+// user-authenticated today.
+func (h *Hub) SetLimiter(l *ratelimit.Limiter) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.limiter = l
+}
+
+// Metrics reports coarse backpressure stats for ops dashboards.
+func (h *Hub) Metrics() map[string]int64 {
+	h.mu.RLock()
+	n := len(h.conns)
+	h.mu.RUnlock()
+	return map[string]int64{
+		"connections":   int64(n),
+		"dropped_total": h.dropped.Load(),
+		"rate_limited":  h.rateLimited.Load(),
+	}
+}
+
+// Publish broadcasts a message for a market to the channels it maps to.
+// msgType follows the engine's existing vocabulary ("book_snapshot",
+// "trade", "order_canceled", ...); channel-scoped types are delivered only
+// to subscribers of the matching structured channel, everything else is
+// broadcast to every channel subscriber for that market (acks, lifecycle
+// events) to preserve pre-existing behavior for non-depth/trade events.
 func (h *Hub) Publish(marketID, msgType string, data any) {
-	msg := Msg{Type: msgType, MarketID: marketID, Data: data}
-	b, err := json.Marshal(msg)
-	if err != nil {
-		return
+	switch msgType {
+	case "book_snapshot":
+		h.publishToKind("orderbook", marketID, "delta", data)
+	case "trade":
+		h.lastTradeUpdate(marketID, data)
+		h.publishToKind("publicTrade", marketID, "snapshot", data)
+		h.publishToKind("tickers", marketID, "delta", data)
+	case "kline":
+		if k, ok := data.(model.Kline); ok {
+			h.mu.Lock()
+			h.lastKline["kline."+k.Interval+"."+marketID] = data
+			h.mu.Unlock()
+			h.publishToChannel(channel{Kind: "kline", Param: k.Interval, MarketID: marketID}, "delta", data)
+		}
+	default:
+		h.broadcastMarket(marketID, msgType, data)
 	}
+}
+
+func (h *Hub) lastTradeUpdate(marketID string, data any) {
+	h.mu.Lock()
+	h.lastTrd[marketID] = data
+	h.mu.Unlock()
+}
+
+func (h *Hub) publishToKind(kind, marketID, typ string, data any) {
 	h.mu.RLock()
-	room := h.rooms[marketID]
+	var targets []*conn
+	var keys []string
+	for key, subs := range h.byChan {
+		// key format: kind.param.marketID
+		parts := strings.SplitN(key, ".", 3)
+		if len(parts) != 3 || parts[0] != kind || parts[2] != marketID {
+			continue
+		}
+		for c := range subs {
+			targets = append(targets, c)
+			keys = append(keys, key)
+		}
+	}
 	h.mu.RUnlock()
-	for c := range room {
-		select {
-		case c.send <- b:
-		default:
-			// slow client, drop
+
+	for i, c := range targets {
+		key := keys[i]
+		seq := h.nextSeq(key)
+		h.sendTo(c, Msg{Topic: key, Type: typ, Data: data, Seq: seq, Ts: time.Now().UnixMilli()})
+	}
+}
+
+// publishToChannel delivers to subscribers of one exact channel key, used
+// where (unlike orderbook depth) the param must match precisely — e.g. a
+// kline.1m subscriber must never see kline.1d bars.
+func (h *Hub) publishToChannel(ch channel, typ string, data any) {
+	key := ch.key()
+	h.mu.RLock()
+	subs := h.byChan[key]
+	targets := make([]*conn, 0, len(subs))
+	for c := range subs {
+		targets = append(targets, c)
+	}
+	h.mu.RUnlock()
+
+	seq := h.nextSeq(key)
+	for _, c := range targets {
+		h.sendTo(c, Msg{Topic: key, Type: typ, Data: data, Seq: seq, Ts: time.Now().UnixMilli()})
+	}
+}
+
+func (h *Hub) broadcastMarket(marketID, msgType string, data any) {
+	h.mu.RLock()
+	seen := map[*conn]bool{}
+	var targets []*conn
+	for key, subs := range h.byChan {
+		if !strings.HasSuffix(key, "."+marketID) {
+			continue
+		}
+		for c := range subs {
+			if !seen[c] {
+				seen[c] = true
+				targets = append(targets, c)
+			}
 		}
 	}
+	h.mu.RUnlock()
+
+	for _, c := range targets {
+		h.sendTo(c, Msg{Type: msgType, Data: data, Ts: time.Now().UnixMilli()})
+	}
+}
+
+func (h *Hub) nextSeq(channelKey string) int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq[channelKey]++
+	return h.seq[channelKey]
+}
+
+func (h *Hub) sendTo(c *conn, msg Msg) {
+	b, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+		h.dropped.Add(1)
+		log.Printf("[ws] dropped message on %s: send queue full", msg.Topic)
+	}
 }
 
 // HandleWS is the HTTP handler for WebSocket connections.
@@ -68,14 +273,21 @@ func (h *Hub) HandleWS(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	c := &conn{
-		ws:   wsConn,
-		send: make(chan []byte, 64),
-		hub:  h,
+		ws:         wsConn,
+		send:       make(chan []byte, sendQueueSize),
+		hub:        h,
+		chans:      make(map[string]channel),
+		remoteAddr: r.RemoteAddr,
 	}
 	h.mu.Lock()
-	h.allConn[c] = true
+	h.conns[c] = true
 	h.mu.Unlock()
 
+	wsConn.SetPongHandler(func(string) error {
+		atomic.StoreInt32(&c.missed, 0)
+		return nil
+	})
+
 	go c.writePump()
 	go c.readPump()
 }
@@ -90,78 +302,199 @@ func (c *conn) readPump() {
 		if err != nil {
 			break
 		}
-		// Parse subscription message: {"action":"subscribe","market_id":"..."}
-		var sub struct {
-			Action   string `json:"action"`
-			MarketID string `json:"market_id"`
+		var req struct {
+			Op   string   `json:"op"`
+			Args []string `json:"args"`
 		}
-		if err := json.Unmarshal(msg, &sub); err != nil {
+		if err := json.Unmarshal(msg, &req); err != nil {
 			continue
 		}
-		switch sub.Action {
-		case "subscribe":
-			c.hub.subscribe(c, sub.MarketID)
-		case "unsubscribe":
-			c.hub.unsubscribe(c, sub.MarketID)
+		switch req.Op {
+		case "subscribe", "unsubscribe":
+			if !c.hub.allowOp(c) {
+				c.hub.rateLimited.Add(1)
+				c.hub.sendRejected(c, req.Op, req.Args)
+				continue
+			}
+			if req.Op == "subscribe" {
+				c.hub.subscribe(c, req.Args)
+			} else {
+				c.hub.unsubscribe(c, req.Args)
+			}
 		}
 	}
 }
 
 func (c *conn) writePump() {
-	defer c.ws.Close()
-	for msg := range c.send {
-		if err := c.ws.WriteMessage(websocket.TextMessage, msg); err != nil {
-			break
+	ticker := time.NewTicker(pingInterval)
+	defer func() {
+		ticker.Stop()
+		c.ws.Close()
+	}()
+	for {
+		select {
+		case msg, ok := <-c.send:
+			if !ok {
+				return
+			}
+			if err := c.ws.WriteMessage(websocket.TextMessage, msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if atomic.AddInt32(&c.missed, 1) > pongMissLimit {
+				log.Printf("[ws] dropping unresponsive connection (missed %d pongs)", pongMissLimit)
+				return
+			}
+			if err := c.ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
 		}
 	}
 }
 
-func (h *Hub) subscribe(c *conn, marketID string) {
+func (h *Hub) subscribe(c *conn, args []string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	// Unsubscribe from previous market if any
-	if c.market != "" {
-		if room, ok := h.rooms[c.market]; ok {
-			delete(room, c)
-			if len(room) == 0 {
-				delete(h.rooms, c.market)
-			}
+	for _, arg := range args {
+		ch, ok := parseChannel(arg)
+		if !ok {
+			continue
+		}
+		key := ch.key()
+		room, ok := h.byChan[key]
+		if !ok {
+			room = make(map[*conn]bool)
+			h.byChan[key] = room
+		}
+		room[c] = true
+		c.mu.Lock()
+		c.chans[key] = ch
+		c.mu.Unlock()
+	}
+	h.mu.Unlock()
+
+	h.sendAck(c, "subscribe", args)
+	for _, arg := range args {
+		ch, ok := parseChannel(arg)
+		if !ok {
+			continue
+		}
+		h.sendInitialSnapshot(c, ch)
+	}
+}
+
+func (h *Hub) sendInitialSnapshot(c *conn, ch channel) {
+	key := ch.key()
+	switch ch.Kind {
+	case "orderbook":
+		h.mu.RLock()
+		src := h.bookSrc
+		h.mu.RUnlock()
+		if src == nil {
+			return
+		}
+		depth, _ := strconv.Atoi(ch.Param)
+		if depth <= 0 {
+			depth = 20
+		}
+		bids, asks := src(ch.MarketID)
+		seq := h.nextSeq(key)
+		h.sendTo(c, Msg{Topic: key, Type: "snapshot", Data: map[string]any{"bids": bids, "asks": asks}, Seq: seq, Ts: time.Now().UnixMilli()})
+	case "tickers":
+		h.mu.RLock()
+		last := h.lastTrd[ch.MarketID]
+		h.mu.RUnlock()
+		if last == nil {
+			return
+		}
+		seq := h.nextSeq(key)
+		h.sendTo(c, Msg{Topic: key, Type: "snapshot", Data: last, Seq: seq, Ts: time.Now().UnixMilli()})
+	case "kline":
+		h.mu.RLock()
+		last, ok := h.lastKline[key]
+		h.mu.RUnlock()
+		if !ok {
+			return
 		}
+		seq := h.nextSeq(key)
+		h.sendTo(c, Msg{Topic: key, Type: "snapshot", Data: last, Seq: seq, Ts: time.Now().UnixMilli()})
+	}
+}
+
+func (h *Hub) sendAck(c *conn, op string, args []string) {
+	h.sendReply(c, op, args, true)
+}
+
+// sendRejected acks a subscribe/unsubscribe op with success=false because
+// the connection's account bucket is exhausted.
+func (h *Hub) sendRejected(c *conn, op string, args []string) {
+	h.sendReply(c, op, args, false)
+}
+
+func (h *Hub) sendReply(c *conn, op string, args []string, success bool) {
+	b, err := json.Marshal(subReply{Op: op, Args: args, Success: success})
+	if err != nil {
+		return
+	}
+	select {
+	case c.send <- b:
+	default:
+		h.dropped.Add(1)
+	}
+}
+
+// allowOp charges one account-bucket token for a subscribe/unsubscribe op,
+// keyed by remote host (port stripped, as the REST limiter does for
+// anonymous callers) since WS connections carry no user identity yet.
+// Allows everything through if no limiter has been wired.
+func (h *Hub) allowOp(c *conn) bool {
+	h.mu.RLock()
+	limiter := h.limiter
+	h.mu.RUnlock()
+	if limiter == nil {
+		return true
 	}
-	c.market = marketID
-	room, ok := h.rooms[marketID]
-	if !ok {
-		room = make(map[*conn]bool)
-		h.rooms[marketID] = room
+	host, _, err := net.SplitHostPort(c.remoteAddr)
+	if err != nil {
+		host = c.remoteAddr
 	}
-	room[c] = true
+	return limiter.Allow(host, ratelimit.RoleAnon, ratelimit.ClassAccount, 1).Allowed
 }
 
-func (h *Hub) unsubscribe(c *conn, marketID string) {
+func (h *Hub) unsubscribe(c *conn, args []string) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-	if room, ok := h.rooms[marketID]; ok {
-		delete(room, c)
-		if len(room) == 0 {
-			delete(h.rooms, marketID)
+	for _, arg := range args {
+		ch, ok := parseChannel(arg)
+		if !ok {
+			continue
 		}
+		key := ch.key()
+		if room, ok := h.byChan[key]; ok {
+			delete(room, c)
+			if len(room) == 0 {
+				delete(h.byChan, key)
+			}
+		}
+		c.mu.Lock()
+		delete(c.chans, key)
+		c.mu.Unlock()
 	}
-	if c.market == marketID {
-		c.market = ""
-	}
+	h.mu.Unlock()
+	h.sendAck(c, "unsubscribe", args)
 }
 
 func (h *Hub) removeConn(c *conn) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	delete(h.allConn, c)
-	if c.market != "" {
-		if room, ok := h.rooms[c.market]; ok {
+	delete(h.conns, c)
+	c.mu.Lock()
+	for key := range c.chans {
+		if room, ok := h.byChan[key]; ok {
 			delete(room, c)
 			if len(room) == 0 {
-				delete(h.rooms, c.market)
+				delete(h.byChan, key)
 			}
 		}
 	}
+	c.mu.Unlock()
 	close(c.send)
 }